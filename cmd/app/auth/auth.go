@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Ways a principal can authenticate.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// Role is what a principal is allowed to do.
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"
+	RoleHost     Role = "host"
+	RoleDoor     Role = "door"
+	RoleReadOnly Role = "read-only"
+)
+
+// Permission is what a route needs.
+type Permission string
+
+const (
+	// Public routes need no credentials at all.
+	Public Permission = "public"
+	// Read is looking at the guest list, the seating and the reports.
+	Read Permission = "read"
+	// CheckIn is registering arrivals and departures.
+	CheckIn Permission = "check-in"
+	// Reservations is booking, changing and cancelling reservations.
+	Reservations Permission = "reservations"
+	// Admin is setting up tables, replacing the guest list and running the
+	// service.
+	Admin Permission = "admin"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin:    {Read, CheckIn, Reservations, Admin},
+	RoleHost:     {Read, CheckIn, Reservations},
+	RoleDoor:     {Read, CheckIn},
+	RoleReadOnly: {Read},
+}
+
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Allows reports whether the role grants permission.
+func (r Role) Allows(permission Permission) bool {
+	if permission == Public {
+		return true
+	}
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Principal is who made a request.
+type Principal struct {
+	Name   string `json:"name"`
+	Role   Role   `json:"role,omitempty"`
+	Method string `json:"method"`
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal a request was authenticated as; false
+// when authentication is off or the route is public.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticator recognises one kind of credentials. ok is false when the
+// request carries none of its kind; err is set when they are not valid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (p Principal, ok bool, err error)
+}
+
+// HashKey is how an API key is stored: the hex SHA-256 of the key. Keys are
+// random, so a plain hash is enough to keep them from being read back.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeys authenticates the X-API-Key header against stored key hashes.
+type APIKeys struct {
+	principals map[string]Principal
+}
+
+// ParseAPIKeys reads a comma separated list of name:role:hash entries, the
+// hash made by HashKey. An entry without a role, name:hash, is refused rather
+// than given one, so that no key becomes an admin by mistake.
+func ParseAPIKeys(s string) (*APIKeys, error) {
+	keys := &APIKeys{principals: map[string]Principal{}}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) == 2 {
+			return nil, fmt.Errorf("API key %s has no role, it must be name:role:hash", parts[0])
+		}
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("API key %q is not name:role:hash", entry)
+		}
+		p := Principal{Name: parts[0], Role: Role(parts[1]), Method: MethodAPIKey}
+		if !p.Role.Valid() {
+			return nil, fmt.Errorf("API key %s: unknown role %q", p.Name, p.Role)
+		}
+		hash := strings.ToLower(parts[2])
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("API key %s: the hash must be 64 hex digits", p.Name)
+		}
+		keys.principals[hash] = p
+	}
+	return keys, nil
+}
+
+func (k *APIKeys) Authenticate(r *http.Request) (Principal, bool, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return Principal{}, false, nil
+	}
+	p, ok := k.principals[HashKey(key)]
+	if !ok {
+		return Principal{}, true, ErrInvalidCredentials
+	}
+	return p, true, nil
+}
+
+// Claims are the claims of a bearer token.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role Role `json:"role"`
+}
+
+// JWT authenticates bearer tokens signed with HMAC-SHA256. A token needs a
+// subject, which names the principal, a role and an expiry.
+type JWT struct {
+	secret   []byte
+	issuer   string
+	audience string
+	parser   *jwt.Parser
+}
+
+// NewJWT accepts tokens signed with secret; issuer and audience are checked
+// when not empty.
+func NewJWT(secret []byte, issuer, audience string) *JWT {
+	return &JWT{secret: secret, issuer: issuer, audience: audience,
+		parser: jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))}
+}
+
+func (j *JWT) Authenticate(r *http.Request) (Principal, bool, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return Principal{}, false, nil
+	}
+	var claims Claims
+	_, err := j.parser.ParseWithClaims(strings.TrimPrefix(header, "Bearer "), &claims,
+		func(*jwt.Token) (interface{}, error) { return j.secret, nil })
+	if err != nil {
+		return Principal{}, true, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if claims.Subject == "" || claims.ExpiresAt == nil || !claims.Role.Valid() ||
+		!claims.VerifyIssuer(j.issuer, j.issuer != "") || !claims.VerifyAudience(j.audience, j.audience != "") {
+		return Principal{}, true, ErrInvalidCredentials
+	}
+	return Principal{Name: claims.Subject, Role: claims.Role, Method: MethodJWT}, true, nil
+}
+
+// Middleware requires every request to be authenticated by one of its
+// authenticators, and its principal to have the role the route needs, but for
+// public routes. The principal is put in the request context, where the
+// handlers and the audit log find it. Without authenticators every request is
+// let through.
+type Middleware struct {
+	authenticators []Authenticator
+	permissions    map[string]Permission
+}
+
+func NewMiddleware(authenticators ...Authenticator) *Middleware {
+	return &Middleware{authenticators: authenticators, permissions: map[string]Permission{}}
+}
+
+// Permissions sets what each route needs, keyed by method and path template,
+// e.g. "POST /tables".
+func (m *Middleware) Permissions(permissions map[string]Permission) {
+	for route, p := range permissions {
+		m.permissions[route] = p
+	}
+}
+
+// Check makes sure every route of router has its permission set, so that no
+// route is added without deciding who may use it.
+func (m *Middleware) Check(router *mux.Router) error {
+	var missing []string
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		t, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return fmt.Errorf("route %s has no methods", t)
+		}
+		for _, method := range methods {
+			if _, ok := m.permissions[method+" "+t]; !ok {
+				missing = append(missing, method+" "+t)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("no permission set for %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (m *Middleware) Enabled() bool {
+	return len(m.authenticators) > 0
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route, permission := m.permission(r)
+		for _, a := range m.authenticators {
+			p, ok, err := a.Authenticate(r)
+			if !ok {
+				continue
+			}
+			if err != nil {
+				log.Printf("%s %s was refused: %v", r.Method, r.URL.Path, err)
+				unauthorized(w, "Invalid credentials")
+				return
+			}
+			if !p.Role.Allows(permission) {
+				log.Printf("%s (%s) may not %s", p.Name, p.Role, route)
+				models.RespondWithError(w, http.StatusForbidden,
+					fmt.Sprintf("The %s role may not %s, it needs the %s permission", p.Role, route, permission))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+			return
+		}
+		if permission == Public {
+			next.ServeHTTP(w, r)
+			return
+		}
+		unauthorized(w, "Authentication required")
+	})
+}
+
+// permission returns the route of r and the permission it needs; a route
+// without one set needs Admin.
+func (m *Middleware) permission(r *http.Request) (string, Permission) {
+	key := r.Method + " " + r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if t, err := route.GetPathTemplate(); err == nil {
+			key = r.Method + " " + t
+		}
+	}
+	if p, ok := m.permissions[key]; ok {
+		return key, p
+	}
+	return key, Admin
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	models.RespondWithError(w, http.StatusUnauthorized, message)
+}
@@ -0,0 +1,406 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/auth"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is everything the API server can be set up with.
+type Config struct {
+	// Listen is the address the API listens on.
+	Listen     string
+	DB         DB
+	Auth       Auth
+	CheckInKey string
+	Event      Event
+	SMTP       SMTP
+	// ReminderLead is how long before the start of the event the reminders go
+	// out, 0 for none.
+	ReminderLead time.Duration
+	Features     Features
+}
+
+type DB struct {
+	Host            string
+	Port            int
+	User            string
+	Password        string
+	Name            string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// The database is waited for with delays from RetryInitial doubling up to
+	// RetryMax, for at most WaitTimeout at startup; 0 waits for ever.
+	RetryInitial time.Duration
+	RetryMax     time.Duration
+	WaitTimeout  time.Duration
+}
+
+// DSN is the data source name of the MySQL driver.
+func (d DB) DSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s", d.User, d.Password, net.JoinHostPort(d.Host, strconv.Itoa(d.Port)), d.Name)
+}
+
+type Auth struct {
+	// APIKeys is a comma separated list of name:role:hash entries.
+	APIKeys     string
+	JWTSecret   string
+	JWTIssuer   string
+	JWTAudience string
+}
+
+type Event struct {
+	Name  string
+	Venue string
+	Start time.Time
+	End   time.Time
+	// Domain ends the UIDs of the calendar files.
+	Domain string
+}
+
+type SMTP struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// Features turns the background parts of the API on and off.
+type Features struct {
+	Webhooks      bool
+	Notifications bool
+	Live          bool
+}
+
+// Defaults is the configuration before any source is applied.
+func Defaults() Config {
+	return Config{
+		Listen:       ":3000",
+		DB: DB{Host: "127.0.0.1", Port: 3306, MaxOpenConns: 20, MaxIdleConns: 10, ConnMaxLifetime: 5 * time.Minute,
+			RetryInitial: time.Second, RetryMax: 30 * time.Second, WaitTimeout: 2 * time.Minute},
+		ReminderLead: 24 * time.Hour,
+		Features:     Features{Webhooks: true, Notifications: true, Live: true},
+	}
+}
+
+// setting is one value of the configuration: its key in a config file and
+// its flag, the environment variable setting it, and whether it is a secret.
+// Secrets can also be read from a file named by key_file, the flag -key_file
+// or ENV_FILE.
+type setting struct {
+	key    string
+	env    string
+	secret bool
+	value  interface{}
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"listen", "LISTEN_ADDR", false, &c.Listen},
+		{"db.host", "DB_HOST", false, &c.DB.Host},
+		{"db.port", "DB_PORT", false, &c.DB.Port},
+		{"db.user", "DB_USER", false, &c.DB.User},
+		{"db.password", "DB_PASSWORD", true, &c.DB.Password},
+		{"db.name", "DB_NAME", false, &c.DB.Name},
+		{"db.max_open_conns", "DB_MAX_OPEN_CONNS", false, &c.DB.MaxOpenConns},
+		{"db.max_idle_conns", "DB_MAX_IDLE_CONNS", false, &c.DB.MaxIdleConns},
+		{"db.conn_max_lifetime", "DB_CONN_MAX_LIFETIME", false, &c.DB.ConnMaxLifetime},
+		{"db.retry_initial", "DB_RETRY_INITIAL", false, &c.DB.RetryInitial},
+		{"db.retry_max", "DB_RETRY_MAX", false, &c.DB.RetryMax},
+		{"db.wait_timeout", "DB_WAIT_TIMEOUT", false, &c.DB.WaitTimeout},
+		{"auth.api_keys", "API_KEYS", false, &c.Auth.APIKeys},
+		{"auth.jwt_secret", "JWT_SECRET", true, &c.Auth.JWTSecret},
+		{"auth.jwt_issuer", "JWT_ISSUER", false, &c.Auth.JWTIssuer},
+		{"auth.jwt_audience", "JWT_AUDIENCE", false, &c.Auth.JWTAudience},
+		{"checkin_key", "CHECKIN_KEY", true, &c.CheckInKey},
+		{"event.name", "EVENT_NAME", false, &c.Event.Name},
+		{"event.venue", "EVENT_VENUE", false, &c.Event.Venue},
+		{"event.start", "EVENT_START", false, &c.Event.Start},
+		{"event.end", "EVENT_END", false, &c.Event.End},
+		{"event.domain", "EVENT_DOMAIN", false, &c.Event.Domain},
+		{"smtp.addr", "SMTP_ADDR", false, &c.SMTP.Addr},
+		{"smtp.from", "SMTP_FROM", false, &c.SMTP.From},
+		{"smtp.username", "SMTP_USERNAME", false, &c.SMTP.Username},
+		{"smtp.password", "SMTP_PASSWORD", true, &c.SMTP.Password},
+		{"notifications.reminder_lead", "REMINDER_LEAD", false, &c.ReminderLead},
+		{"features.webhooks", "FEATURE_WEBHOOKS", false, &c.Features.Webhooks},
+		{"features.notifications", "FEATURE_NOTIFICATIONS", false, &c.Features.Notifications},
+		{"features.live", "FEATURE_LIVE", false, &c.Features.Live},
+	}
+}
+
+// set parses v into the setting.
+func (s setting) set(v string) error {
+	if p, ok := s.value.(*string); ok {
+		*p = v
+		return nil
+	}
+	v = strings.TrimSpace(v)
+	switch p := s.value.(type) {
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", v)
+		}
+		*p = n
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", v)
+		}
+		*p = b
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 90s or 24h", v)
+		}
+		*p = d
+	case *time.Time:
+		if v == "" {
+			*p = time.Time{}
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("%q is not an RFC 3339 time", v)
+		}
+		*p = t
+	}
+	return nil
+}
+
+func (s setting) String() string {
+	switch p := s.value.(type) {
+	case *string:
+		return *p
+	case *int:
+		return strconv.Itoa(*p)
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *time.Duration:
+		return p.String()
+	case *time.Time:
+		if p.IsZero() {
+			return ""
+		}
+		return p.Format(time.RFC3339)
+	}
+	return ""
+}
+
+// Load merges, each over the one before, the defaults, the config file named
+// by the -config flag or CONFIG_FILE, the environment as seen through env and
+// the flags in args, and validates the outcome. Empty environment variables
+// count as unset. Every problem found is reported at once.
+func Load(args []string, env func(string) (string, bool)) (Config, error) {
+	c := Defaults()
+	settings := c.settings()
+	var problems []string
+	add := func(source string, err error) {
+		problems = append(problems, source+": "+err.Error())
+	}
+
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	configFile := fs.String("config", "", "the YAML or JSON config file, or CONFIG_FILE")
+	flags := map[string]*string{}
+	for _, s := range settings {
+		flags[s.key] = fs.String(s.key, "", "or "+s.env)
+		if s.secret {
+			flags[s.key+"_file"] = fs.String(s.key+"_file", "", "a file holding "+s.key+", or "+s.env+"_FILE")
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if fs.NArg() > 0 {
+		return c, fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+
+	path := *configFile
+	if path == "" {
+		path, _ = env("CONFIG_FILE")
+	}
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return c, err
+		}
+		for _, s := range settings {
+			if v, ok := values[s.key]; ok {
+				delete(values, s.key)
+				if err := s.set(v); err != nil {
+					add(path+": "+s.key, err)
+				}
+			}
+			if v, ok := values[s.key+"_file"]; ok && s.secret {
+				delete(values, s.key+"_file")
+				if err := setFromFile(s, v); err != nil {
+					add(path+": "+s.key+"_file", err)
+				}
+			}
+		}
+		for _, key := range sortedKeys(values) {
+			problems = append(problems, path+": unknown setting "+key)
+		}
+	}
+
+	for _, s := range settings {
+		if v, _ := env(s.env); v != "" {
+			if err := s.set(v); err != nil {
+				add(s.env, err)
+			}
+		}
+		if v, _ := env(s.env + "_FILE"); v != "" && s.secret {
+			if err := setFromFile(s, v); err != nil {
+				add(s.env+"_FILE", err)
+			}
+		}
+	}
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, s := range settings {
+		if given[s.key] {
+			if err := s.set(*flags[s.key]); err != nil {
+				add("-"+s.key, err)
+			}
+		}
+		if given[s.key+"_file"] {
+			if err := setFromFile(s, *flags[s.key+"_file"]); err != nil {
+				add("-"+s.key+"_file", err)
+			}
+		}
+	}
+
+	problems = append(problems, c.problems()...)
+	if len(problems) > 0 {
+		return c, fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return c, nil
+}
+
+// problems lists what is missing or inconsistent in the configuration.
+func (c Config) problems() []string {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	if _, port, err := net.SplitHostPort(c.Listen); err != nil {
+		problems = append(problems, fmt.Sprintf("listen: %q is not host:port", c.Listen))
+	} else {
+		n, err := strconv.Atoi(port)
+		check(err == nil && n >= 0 && n <= 65535, "listen: %q is not a port", port)
+	}
+	check(c.DB.Host != "", "db.host must be set")
+	check(c.DB.Port > 0 && c.DB.Port <= 65535, "db.port: %d is not a port", c.DB.Port)
+	check(c.DB.User != "", "db.user must be set")
+	check(c.DB.Name != "", "db.name must be set")
+	check(c.DB.MaxOpenConns >= 1, "db.max_open_conns must be at least 1")
+	check(c.DB.MaxIdleConns >= 0 && c.DB.MaxIdleConns <= c.DB.MaxOpenConns,
+		"db.max_idle_conns must be between 0 and db.max_open_conns")
+	check(c.DB.ConnMaxLifetime >= 0, "db.conn_max_lifetime must not be negative")
+	check(c.DB.RetryInitial > 0, "db.retry_initial must be positive")
+	check(c.DB.RetryMax >= c.DB.RetryInitial, "db.retry_max must not be less than db.retry_initial")
+	check(c.DB.WaitTimeout >= 0, "db.wait_timeout must not be negative")
+	if _, err := auth.ParseAPIKeys(c.Auth.APIKeys); err != nil {
+		problems = append(problems, "auth.api_keys: "+err.Error())
+	}
+	check(c.Auth.JWTSecret == "" || len(c.Auth.JWTSecret) >= 32, "auth.jwt_secret must be at least 32 characters")
+	check(c.Event.End.IsZero() || c.Event.End.After(c.Event.Start), "event.end must be after event.start")
+	if c.SMTP.Addr != "" {
+		_, _, err := net.SplitHostPort(c.SMTP.Addr)
+		check(err == nil, "smtp.addr: %q is not host:port", c.SMTP.Addr)
+		check(c.SMTP.From != "", "smtp.from must be set with smtp.addr")
+	}
+	check(c.ReminderLead >= 0, "notifications.reminder_lead must not be negative")
+	return problems
+}
+
+// Print writes the configuration, one key = value per line, with the secrets
+// that are set redacted.
+func (c Config) Print(w io.Writer) {
+	for _, s := range c.settings() {
+		v := s.String()
+		if s.secret && v != "" {
+			v = "[redacted]"
+		}
+		fmt.Fprintf(w, "%s = %s\n", s.key, v)
+	}
+}
+
+// readFile reads a YAML or JSON config file, by its extension, into its
+// settings keyed as in settings, e.g. "db.port".
+func readFile(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &doc)
+	case ".json":
+		err = json.Unmarshal(b, &doc)
+	default:
+		return nil, fmt.Errorf("%s: the config file must be .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	values := map[string]string{}
+	flatten("", doc, values)
+	return values, nil
+}
+
+func flatten(prefix string, doc map[string]interface{}, values map[string]string) {
+	for k, v := range doc {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flatten(prefix+k+".", v, values)
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[prefix+k] = strings.Join(items, ",")
+		case time.Time:
+			values[prefix+k] = v.Format(time.RFC3339)
+		case nil:
+			values[prefix+k] = ""
+		default:
+			values[prefix+k] = fmt.Sprint(v)
+		}
+	}
+}
+
+// setFromFile sets a secret to the content of the file at path, without the
+// line break editors leave at its end.
+func setFromFile(s setting, path string) error {
+	b, err := ioutil.ReadFile(strings.TrimSpace(path))
+	if err != nil {
+		return err
+	}
+	return s.set(strings.TrimRight(string(b), "\r\n"))
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
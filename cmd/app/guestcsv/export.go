@@ -0,0 +1,106 @@
+package guestcsv
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"io"
+	"strconv"
+)
+
+// exportColumns keep the names the import understands, so an exported list
+// can be edited and imported again.
+var exportColumns = []string{"name", "table_id", "table_group_id", "tables", "accompanying_guests", "status",
+	"arrival_time", "confirmation_code", "diet", "gluten_free", "nut_allergy", "dietary_needs"}
+
+// Writer writes a guest list one reservation at a time. Output is buffered
+// and sent on in small chunks; Flush must be called at the end.
+type Writer interface {
+	Write(guest models.GuestsReservation) error
+	Flush() error
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// NewCSVWriter writes a header row followed by one row per reservation.
+func NewCSVWriter(w io.Writer) (Writer, error) {
+	c := &csvWriter{w: csv.NewWriter(w)}
+	return c, c.w.Write(exportColumns)
+}
+
+func (c *csvWriter) Write(guest models.GuestsReservation) error {
+	var arrival string
+	if guest.ArrivalTime != 0 {
+		arrival = guest.ArrivalTime.String()
+	}
+	var group string
+	if guest.TableGroupId != 0 {
+		group = strconv.FormatInt(guest.TableGroupId, 10)
+	}
+	return c.w.Write([]string{
+		guest.Name,
+		strconv.FormatInt(int64(guest.TableId), 10),
+		group,
+		models.TableNumbers(guest.TableId, guest.Tables),
+		strconv.FormatInt(guest.AccompanyingGuests, 10),
+		strconv.Itoa(int(guest.Status)),
+		arrival,
+		guest.ConfirmationCode,
+		string(guest.Diet),
+		strconv.FormatBool(guest.GlutenFree),
+		strconv.FormatBool(guest.NutAllergy),
+		guest.DietaryNeeds,
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewNDJSONWriter writes each reservation as a JSON object on its own line.
+func NewNDJSONWriter(w io.Writer) (Writer, error) {
+	buf := bufio.NewWriter(w)
+	return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}, nil
+}
+
+func (n *ndjsonWriter) Write(guest models.GuestsReservation) error {
+	return n.enc.Encode(guest)
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.buf.Flush()
+}
+
+const doorListLine = "%-40s %-12s %5v\n"
+
+type doorListWriter struct {
+	buf *bufio.Writer
+}
+
+// NewDoorListWriter writes a plain-text list for printing: one line per
+// party with its table numbers and party size. The rows are printed in the
+// order they are written, so callers pass them sorted by name.
+func NewDoorListWriter(w io.Writer) (Writer, error) {
+	d := &doorListWriter{buf: bufio.NewWriter(w)}
+	_, err := fmt.Fprintf(d.buf, doorListLine, "NAME", "TABLE", "PARTY")
+	return d, err
+}
+
+func (d *doorListWriter) Write(guest models.GuestsReservation) error {
+	_, err := fmt.Fprintf(d.buf, doorListLine, guest.Name, models.TableNumbers(guest.TableId, guest.Tables), guest.AccompanyingGuests)
+	return err
+}
+
+func (d *doorListWriter) Flush() error {
+	return d.buf.Flush()
+}
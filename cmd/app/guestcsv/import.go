@@ -0,0 +1,172 @@
+package guestcsv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const maxNameLength = 100
+
+var requiredColumns = []string{"name", "accompanying_guests"}
+
+// Parse reads a guest list with a header row. Every row is checked and all
+// problems are reported, so a spreadsheet can be fixed in one go. Row numbers
+// count the header as row 1, as spreadsheets do.
+func Parse(r io.Reader) ([]models.ImportRow, []models.RowError, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, []models.RowError{{Row: 1, Message: "the file is empty"}}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range requiredColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, []models.RowError{{Row: 1, Message: "missing column " + name}}, nil
+		}
+	}
+	_, hasTable := columns["table_id"]
+	_, hasGroup := columns["table_group_id"]
+	if !hasTable && !hasGroup {
+		return nil, []models.RowError{{Row: 1, Message: "missing column table_id"}}, nil
+	}
+
+	var rows []models.ImportRow
+	var rowErrors []models.RowError
+	seen := map[string]int{}
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				rowErrors = append(rowErrors, models.RowError{Row: row, Message: err.Error()})
+				continue
+			}
+			return nil, nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		guest, problems := parseRow(field)
+		if first, ok := seen[strings.ToLower(guest.Name)]; ok && guest.Name != "" {
+			problems = append(problems, fmt.Sprintf("%s is already on row %d", guest.Name, first))
+		} else {
+			seen[strings.ToLower(guest.Name)] = row
+		}
+		for _, p := range problems {
+			rowErrors = append(rowErrors, models.RowError{Row: row, Name: guest.Name, Message: p})
+		}
+		rows = append(rows, models.ImportRow{Row: row, GuestsReservation: guest})
+	}
+	return rows, rowErrors, nil
+}
+
+func parseRow(field func(string) string) (models.GuestsReservation, []string) {
+	var guest models.GuestsReservation
+	var problems []string
+
+	guest.Name = field("name")
+	if guest.Name == "" || len(guest.Name) > maxNameLength {
+		problems = append(problems, "invalid name")
+	}
+	if v := field("table_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || id <= 0 {
+			problems = append(problems, "invalid table_id "+v)
+		}
+		guest.TableId = int32(id)
+	}
+	if v := field("table_group_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			problems = append(problems, "invalid table_group_id "+v)
+		}
+		guest.TableGroupId = id
+	}
+	if field("table_id") == "" && field("table_group_id") == "" {
+		problems = append(problems, "either table_id or table_group_id is required")
+	}
+	n, err := strconv.ParseInt(field("accompanying_guests"), 10, 64)
+	if err != nil || n <= 0 {
+		problems = append(problems, "invalid accompanying_guests "+field("accompanying_guests"))
+	}
+	guest.AccompanyingGuests = n
+
+	guest.Diet = models.Diet(strings.ToLower(field("diet")))
+	if !guest.Diet.Valid() {
+		problems = append(problems, "invalid diet "+field("diet"))
+	}
+	for _, flag := range []struct {
+		column string
+		value  *bool
+	}{{"gluten_free", &guest.GlutenFree}, {"nut_allergy", &guest.NutAllergy}} {
+		if v := field(flag.column); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				problems = append(problems, "invalid "+flag.column+" "+v)
+			}
+			*flag.value = b
+		}
+	}
+	guest.DietaryNeeds = field("dietary_needs")
+	return guest, problems
+}
+
+// CheckRows applies the checks of Parse to a guest list that did not come
+// from a file, such as a JSON body. Rows are numbered from 1.
+func CheckRows(guests []models.GuestsReservation) ([]models.ImportRow, []models.RowError) {
+	rows := make([]models.ImportRow, len(guests))
+	var rowErrors []models.RowError
+	seen := map[string]int{}
+	for i, guest := range guests {
+		row := i + 1
+		guest.Name = strings.TrimSpace(guest.Name)
+		var problems []string
+		if guest.Name == "" || len(guest.Name) > maxNameLength {
+			problems = append(problems, "invalid name")
+		}
+		if guest.TableId <= 0 && guest.TableGroupId <= 0 {
+			problems = append(problems, "either table_id or table_group_id is required")
+		}
+		if guest.AccompanyingGuests <= 0 {
+			problems = append(problems, fmt.Sprintf("invalid accompanying_guests %v", guest.AccompanyingGuests))
+		}
+		if !guest.Diet.Valid() {
+			problems = append(problems, "invalid diet "+string(guest.Diet))
+		}
+		if !models.ValidEmail(guest.Email) {
+			problems = append(problems, "invalid email "+guest.Email)
+		}
+		if first, ok := seen[strings.ToLower(guest.Name)]; ok && guest.Name != "" {
+			problems = append(problems, fmt.Sprintf("%s is already on row %d", guest.Name, first))
+		} else {
+			seen[strings.ToLower(guest.Name)] = row
+		}
+		for _, p := range problems {
+			rowErrors = append(rowErrors, models.RowError{Row: row, Name: guest.Name, Message: p})
+		}
+		rows[i] = models.ImportRow{Row: row, GuestsReservation: guest}
+	}
+	return rows, rowErrors
+}
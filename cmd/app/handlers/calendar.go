@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/ical"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"time"
+)
+
+// GetEventCalendar sends the event itself as a calendar file.
+func (s *Post) GetEventCalendar(w http.ResponseWriter, r *http.Request) {
+	if !s.hasEventTime(w) {
+		return
+	}
+	s.respondWithCalendar(w, "event.ics", ical.Event{
+		UID:      "event@" + s.calendarDomain(),
+		Summary:  s.event.Name,
+		Location: s.event.Venue,
+		Start:    s.event.Start,
+		End:      s.event.End,
+		Status:   ical.Confirmed,
+	})
+}
+
+func (s *Post) GetReservationCalendarByCode(w http.ResponseWriter, r *http.Request) {
+	if !s.hasEventTime(w) {
+		return
+	}
+	params:= mux.Vars(r)
+	reservation, err:= s.repo.GetReservationByCode(r.Context(), params["code"])
+	if err!=nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	s.respondWithCalendar(w, "reservation.ics", s.reservationEvent(reservation))
+}
+
+func (s *Post) GetOwnReservationCalendar(w http.ResponseWriter, r *http.Request) {
+	if !s.hasEventTime(w) {
+		return
+	}
+	params:= mux.Vars(r)
+	reservation, err:= s.repo.GetReservationByToken(r.Context(), params["token"])
+	if err!=nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	s.respondWithCalendar(w, "reservation.ics", s.reservationEvent(&models.GuestsReservation{
+		Name:               reservation.Name,
+		ConfirmationCode:   reservation.ConfirmationCode,
+		Status:             reservation.Status,
+		AccompanyingGuests: reservation.AccompanyingGuests,
+		TableId:            reservation.TableId,
+		Tables:             reservation.Tables,
+	}))
+}
+
+// reservationEvent describes one party's place at the event. The confirmation
+// code identifies the event across updates of the calendar file.
+func (s *Post) reservationEvent(reservation *models.GuestsReservation) ical.Event {
+	location := "Table " + models.TableNumbers(reservation.TableId, reservation.Tables)
+	if len(reservation.Tables) > 1 {
+		location = "Tables " + models.TableNumbers(reservation.TableId, reservation.Tables)
+	}
+	if s.event.Venue != "" {
+		location = s.event.Venue + ", " + location
+	}
+	summary := s.event.Name
+	if summary == "" {
+		summary = "Reservation for " + reservation.Name
+	}
+	return ical.Event{
+		UID:         "reservation-" + reservation.ConfirmationCode + "@" + s.calendarDomain(),
+		Summary:     summary,
+		Location:    location,
+		Description: fmt.Sprintf("Reservation for %s, party of %d.\nConfirmation code: %s",
+			reservation.Name, reservation.AccompanyingGuests, reservation.ConfirmationCode),
+		Start:       s.event.Start,
+		End:         s.event.End,
+		Status:      calendarStatus(reservation.Status),
+	}
+}
+
+func calendarStatus(status models.Status) string {
+	switch status {
+	case models.Invited:
+		return ical.Tentative
+	case models.Declined, models.Cancelled:
+		return ical.Cancelled
+	default:
+		return ical.Confirmed
+	}
+}
+
+// defaultCalendarDomain ends the UIDs when no domain is configured.
+const defaultCalendarDomain = "guest-list.invalid"
+
+// calendarDomain is the right-hand side of the UIDs, so that they are unique
+// to this service. It comes from the configuration, never from the request,
+// so that a reservation keeps its UID whichever host name it is fetched by.
+func (s *Post) calendarDomain() string {
+	if s.event.Domain == "" {
+		return defaultCalendarDomain
+	}
+	return s.event.Domain
+}
+
+func (s *Post) hasEventTime(w http.ResponseWriter) bool {
+	if s.event.Start.IsZero() {
+		models.RespondWithError(w, http.StatusNotFound, "The event has no start time")
+		log.Println("Calendar requested but EVENT_START is not set")
+		return false
+	}
+	return true
+}
+
+func (s *Post) respondWithCalendar(w http.ResponseWriter, filename string, event ical.Event) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+	if err := ical.Write(w, []ical.Event{event}, time.Now()); err != nil {
+		log.Printf("Cannot write %s, error=%v", filename, err)
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/checkin"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/gorilla/mux"
+	"github.com/skip2/go-qrcode"
+	"log"
+	"net/http"
+)
+
+const qrCodeSize = 256
+
+type checkInRequest struct {
+	Token				string			`json:"token"`
+	AccompanyingGuests	int64			`json:"accompanying_guests"`
+}
+
+func (s *Post) GetCheckInQRByCode(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	reservation, err:= s.repo.GetReservationByCode(r.Context(), params["code"])
+	if err!=nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	s.respondWithQR(w, reservation.Id)
+}
+
+func (s *Post) GetOwnCheckInQR(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	reservation, err:= s.repo.GetReservationByToken(r.Context(), params["token"])
+	if err!=nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	s.respondWithQR(w, reservation.Id)
+}
+
+func (s *Post) respondWithQR(w http.ResponseWriter, reservationId int64) {
+	png, err := qrcode.Encode(s.checkIn.Sign(reservationId), qrcode.Medium, qrCodeSize)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(http.StatusOK)
+	w.Write(png)
+}
+
+// CheckInWithToken is called by the door scanner with the content of a QR
+// code.
+func (s *Post) CheckInWithToken(w http.ResponseWriter, r *http.Request) {
+	var request checkInRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	if request.AccompanyingGuests < 0 {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid guest number")
+		return
+	}
+	reservationId, err := s.checkIn.Verify(request.Token)
+	if err != nil {
+		models.RespondWithError(w, http.StatusForbidden, checkin.ErrInvalidToken.Error())
+		log.Println("Check-in with an invalid token")
+		return
+	}
+
+	guest := models.GuestsReservation{AccompanyingGuests: request.AccompanyingGuests}
+	err = s.repo.CheckInById(r.Context(), reservationId, &guest)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, guest)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+func (s *Post) GetReservationByCode(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	reservation, err:= s.repo.GetReservationByCode(r.Context(), params["code"])
+	if err!=nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, reservation)
+}
+
+func (s *Post) CheckInByCode(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	var guestsReservation models.GuestsReservation
+	err := json.NewDecoder(r.Body).Decode(&guestsReservation)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		log.Println("There was an error decoding the request body into the struct")
+		return
+	}
+	defer r.Body.Close()
+
+	if guestsReservation.AccompanyingGuests <=0 {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid guest number")
+		log.Printf("Accompanying guests number %v should be greater than zero", guestsReservation.AccompanyingGuests)
+		return
+	}
+
+	err = s.repo.CheckInByCode(r.Context(), params["code"], &guestsReservation)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, models.GuestDtoFromEntity(guestsReservation))
+}
+
+func (s *Post) CancelByCode(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	err := s.repo.CancelByCode(r.Context(), params["code"])
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
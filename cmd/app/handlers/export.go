@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"github.com/getground/tech-tasks/backend/cmd/app/guestcsv"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type exportFormat struct {
+	name        string
+	mediaTypes  []string
+	contentType string
+	extension   string
+	newWriter   func(io.Writer) (guestcsv.Writer, error)
+}
+
+// exportFormats are the alternatives to the JSON lists. The first media type
+// of each is the one announced in responses.
+var exportFormats = []exportFormat{
+	{"csv", []string{"text/csv"}, "text/csv; charset=utf-8", ".csv", guestcsv.NewCSVWriter},
+	{"ndjson", []string{"application/x-ndjson", "application/ndjson"}, "application/x-ndjson", ".ndjson",
+		guestcsv.NewNDJSONWriter},
+	{"door", []string{"text/plain"}, "text/plain; charset=utf-8", ".txt", guestcsv.NewDoorListWriter},
+}
+
+// negotiateExport picks the export format asked for with ?format= or, failing
+// that, the Accept header. It returns nil when the usual JSON is wanted.
+func negotiateExport(r *http.Request) *exportFormat {
+	if name := r.URL.Query().Get("format"); name != "" {
+		for i := range exportFormats {
+			if exportFormats[i].name == name {
+				return &exportFormats[i]
+			}
+		}
+		return nil
+	}
+
+	var best *exportFormat
+	bestQ := 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			best, bestQ = nil, q
+		default:
+			for i := range exportFormats {
+				for _, t := range exportFormats[i].mediaTypes {
+					if t == mediaType {
+						best, bestQ = &exportFormats[i], q
+					}
+				}
+			}
+		}
+	}
+	return best
+}
+
+// guestStream calls fn for each reservation to export, in order.
+type guestStream func(fn func(models.GuestsReservation) error) error
+
+// liveGuests streams the guest list, or the arrived parties, from the
+// database.
+func (s *Post) liveGuests(r *http.Request, arrivedOnly bool) guestStream {
+	return func(fn func(models.GuestsReservation) error) error {
+		return s.repo.StreamGuests(r.Context(), arrivedOnly, fn)
+	}
+}
+
+// exportGuests writes the reservations stream hands over in a negotiated
+// export format. It reports false, without writing anything, when JSON should
+// be sent instead.
+// Once rows have been sent an error can no longer change the status, so it is
+// only logged and the output ends early.
+func (s *Post) exportGuests(w http.ResponseWriter, r *http.Request, stream guestStream, filename string) bool {
+	format := negotiateExport(r)
+	if format == nil {
+		return false
+	}
+
+	var out guestcsv.Writer
+	start := func() error {
+		w.Header().Set("Content-Type", format.contentType)
+		if format.name == "csv" {
+			w.Header().Set("Content-Disposition", `attachment; filename="`+filename+format.extension+`"`)
+		}
+		w.WriteHeader(http.StatusOK)
+		var err error
+		out, err = format.newWriter(w)
+		return err
+	}
+	started := false
+	err := stream(func(guest models.GuestsReservation) error {
+		if !started {
+			started = true
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return out.Write(guest)
+	})
+	if err == nil && !started {
+		started = true
+		err = start()
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		if !started {
+			models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return true
+		}
+		log.Printf("Export of %s stopped early, error=%v", filename, err)
+	}
+	return true
+}
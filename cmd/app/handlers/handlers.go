@@ -3,17 +3,27 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/checkin"
+	"github.com/getground/tech-tasks/backend/cmd/app/health"
+	"github.com/getground/tech-tasks/backend/cmd/app/live"
 	"github.com/getground/tech-tasks/backend/cmd/app/models"
 	"github.com/getground/tech-tasks/backend/cmd/app/repository"
 	"github.com/getground/tech-tasks/backend/cmd/app/repository/database"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 
 type Post struct {
 	repo repository.GuestRepo
+	checkIn *checkin.Signer
+	event models.Event
+	live *live.Hub
+	streamLimit time.Duration
+	health *health.Checker
 }
 
 func NewHandlerFunc(db *sql.DB) *Post {
@@ -22,6 +32,23 @@ func NewHandlerFunc(db *sql.DB) *Post {
 	}
 }
 
+// SetCheckInKey sets the key check-in tokens are signed with; without one a
+// random key is used.
+func (s *Post) SetCheckInKey(key []byte) error {
+	signer, err := checkin.NewSigner(key)
+	if err != nil {
+		return err
+	}
+	s.checkIn = signer
+	return nil
+}
+
+// SetEvent sets the name, place and time of the event, used by the calendar
+// files.
+func (s *Post) SetEvent(event models.Event) {
+	s.event = event
+}
+
 func (s *Post) CreateTable(w http.ResponseWriter, r *http.Request) {
 	var table models.Table
 	err := json.NewDecoder(r.Body).Decode(&table)
@@ -74,6 +101,16 @@ func (s *Post) CreateGuestsListEntry(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Invalid guest number %v", guestsReservation.AccompanyingGuests)
 		return
 	}
+	if !guestsReservation.Diet.Valid() {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid diet")
+		log.Printf("Invalid diet %q", guestsReservation.Diet)
+		return
+	}
+	if !models.ValidEmail(guestsReservation.Email) {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid email")
+		log.Printf("Invalid email %q", guestsReservation.Email)
+		return
+	}
 
 	err = s.repo.CreateGuestReservationID(r.Context(), &guestsReservation)
 	if err != nil {
@@ -110,7 +147,7 @@ func (s *Post) UpdateGuestsList(w http.ResponseWriter, r *http.Request) {
 
 	err = s.repo.CheckAvailableSeats(r.Context(), &guestsReservation)
 	if err != nil {
-		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithRepoError(w, err)
 		return
 	}
 	mappedResult:= models.GuestDtoFromEntity(models.GuestsReservation(guestsReservation))
@@ -118,6 +155,18 @@ func (s *Post) UpdateGuestsList(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Post) GetGuestsList(w http.ResponseWriter, r *http.Request) {
+	at, err := asOf(r)
+	if err != nil {
+		models.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !at.IsZero() {
+		s.respondWithGuestsAsOf(w, r, at, false, "guest_list")
+		return
+	}
+	if s.exportGuests(w, r, s.liveGuests(r, false), "guest_list") {
+		return
+	}
 	guests, err:= s.repo.GetGuestsList()
 	if err!=nil {
 		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
@@ -127,6 +176,18 @@ func (s *Post) GetGuestsList(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Post) GetArrivedGuests(w http.ResponseWriter, r *http.Request) {
+	at, err := asOf(r)
+	if err != nil {
+		models.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !at.IsZero() {
+		s.respondWithGuestsAsOf(w, r, at, true, "arrived_guests")
+		return
+	}
+	if s.exportGuests(w, r, s.liveGuests(r, true), "arrived_guests") {
+		return
+	}
 	guests, err:= s.repo.GetArrivedGuests()
 	if err!=nil {
 		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
@@ -136,6 +197,24 @@ func (s *Post) GetArrivedGuests(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Post) GetEmptySeats(w http.ResponseWriter, r *http.Request) {
+	at, err := asOf(r)
+	if err != nil {
+		models.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !at.IsZero() {
+		plan, err := s.seatingAsOf(r.Context(), at)
+		if err != nil {
+			models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		var empty int32
+		for _, t := range plan.Tables {
+			empty += int32(t.AvailableSeats)
+		}
+		models.RespondwithJSON(w, http.StatusOK, models.Seats{SeatsEmpty: empty})
+		return
+	}
 	emptySeats, err:= s.repo.GetEmptySeats()
 	if err!=nil {
 		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
@@ -155,9 +234,212 @@ func (s *Post) GuestLeaves(w http.ResponseWriter, r *http.Request) {
 
 	err:= s.repo.GuestLeaves(r.Context(), name)
 	if err!=nil {
-		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithRepoError(w, err)
 		return
 	}
 	models.RespondwithJSON(w, http.StatusNoContent, name)
 }
 
+
+func (s *Post) CreateTableGroup(w http.ResponseWriter, r *http.Request) {
+	var group models.TableGroup
+	err := json.NewDecoder(r.Body).Decode(&group)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if group.Name == "" || len(group.TableIds) < 2 {
+		models.RespondWithError(w, http.StatusBadRequest, "A table group needs a name and at least two tables")
+		log.Printf("Invalid table group %q with tables %v", group.Name, group.TableIds)
+		return
+	}
+
+	err = s.repo.CreateTableGroup(r.Context(), &group)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, group)
+}
+
+func (s *Post) GetTableGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err:= s.repo.GetTableGroups()
+	if err!=nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, groups)
+}
+
+func (s *Post) MoveGuestsListEntry(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	name := params["name"]
+	if name == "" {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid guest name")
+		log.Println("Invalid guest name")
+		return
+	}
+
+	guestsReservation:= models.GuestsReservation{Name: name}
+	err := json.NewDecoder(r.Body).Decode(&guestsReservation)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		log.Println("There was an error decoding the request body into the struct")
+		return
+	}
+	defer r.Body.Close()
+
+	if guestsReservation.TableId <= 0 && guestsReservation.TableGroupId <= 0 {
+		models.RespondWithError(w, http.StatusBadRequest, "Either table_id or table_group_id is required")
+		return
+	}
+
+	err = s.repo.MoveReservation(r.Context(), &guestsReservation)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	mappedResult:= models.GuestDtoFromEntity(guestsReservation)
+	models.RespondwithJSON(w, http.StatusOK, mappedResult)
+}
+
+func (s *Post) GetTableSeats(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	tableId, err := strconv.ParseInt(params["id"], 10, 32)
+	if err != nil || tableId <= 0 {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid table id")
+		return
+	}
+
+	seats, err:= s.repo.GetTableSeats(r.Context(), int32(tableId))
+	if err!=nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, seats)
+}
+
+func (s *Post) AssignSeats(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	name := params["name"]
+	if name == "" {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid guest name")
+		log.Println("Invalid guest name")
+		return
+	}
+
+	var assignments models.SeatAssignmentList
+	err := json.NewDecoder(r.Body).Decode(&assignments)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		log.Println("There was an error decoding the request body into the struct")
+		return
+	}
+	defer r.Body.Close()
+
+	if len(assignments.Assignments) == 0 {
+		models.RespondWithError(w, http.StatusBadRequest, "No seat assignments given")
+		return
+	}
+
+	err = s.repo.AssignSeats(r.Context(), name, assignments.Assignments)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, models.GuestDto{Name: name})
+}
+
+func (s *Post) GetPartyMembers(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	members, err:= s.repo.GetPartyMembers(r.Context(), params["name"])
+	if err!=nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, members)
+}
+
+func (s *Post) AddPartyMember(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	member, ok := decodePartyMember(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.repo.AddPartyMember(r.Context(), params["name"], member)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, member)
+}
+
+func (s *Post) UpdatePartyMember(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	memberId, err := strconv.ParseInt(params["id"], 10, 64)
+	if err != nil {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid party member id")
+		return
+	}
+	member, ok := decodePartyMember(w, r)
+	if !ok {
+		return
+	}
+	member.Id = memberId
+
+	err = s.repo.UpdatePartyMember(r.Context(), params["name"], member)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, member)
+}
+
+func (s *Post) RemovePartyMember(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	memberId, err := strconv.ParseInt(params["id"], 10, 64)
+	if err != nil {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid party member id")
+		return
+	}
+
+	err = s.repo.RemovePartyMember(r.Context(), params["name"], memberId)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodePartyMember(w http.ResponseWriter, r *http.Request) (*models.PartyMember, bool) {
+	var member models.PartyMember
+	err := json.NewDecoder(r.Body).Decode(&member)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		log.Println("There was an error decoding the request body into the struct")
+		return nil, false
+	}
+	defer r.Body.Close()
+
+	if member.AgeGroup == "" {
+		member.AgeGroup = models.Adult
+	}
+	if member.Name == "" || !member.AgeGroup.Valid() || !member.Diet.Valid() {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid party member")
+		log.Printf("Invalid party member %q, age group %q", member.Name, member.AgeGroup)
+		return nil, false
+	}
+	return &member, true
+}
+
+func (s *Post) GetCateringReport(w http.ResponseWriter, r *http.Request) {
+	report, err:= s.repo.GetCateringReport(r.Context())
+	if err!=nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"github.com/getground/tech-tasks/backend/cmd/app/health"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+)
+
+// SetHealth sets what tells whether the database is available.
+func (s *Post) SetHealth(checker *health.Checker) {
+	s.health = checker
+}
+
+// GetReadiness answers 200 while the database is available and 503 while it
+// is not, for load balancers and orchestrators to route traffic by.
+func (s *Post) GetReadiness(w http.ResponseWriter, r *http.Request) {
+	if s.health != nil && s.health.Ready() != nil {
+		w.Header().Set("Retry-After", "5")
+		models.RespondwithJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "database unavailable"})
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/getground/tech-tasks/backend/cmd/app/history"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const auditPageSize = 1000
+
+// asOf reads the moment a read endpoint should answer for from ?as_of=, an
+// RFC 3339 time. Without it the zero time is returned, meaning now.
+func asOf(r *http.Request) (time.Time, error) {
+	v := r.URL.Query().Get("as_of")
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, errors.New("as_of must be an RFC 3339 time")
+	}
+	return t, nil
+}
+
+// seatingAsOf rebuilds the seating plan at t from the audit log.
+func (s *Post) seatingAsOf(ctx context.Context, t time.Time) (*models.SeatingPlan, error) {
+	var entries []models.AuditEntry
+	filter := models.AuditFilter{To: t, Limit: auditPageSize}
+	for {
+		page, err := s.repo.GetAuditLog(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page.Entries...)
+		if len(page.Entries) < auditPageSize {
+			break
+		}
+		filter.AfterId = page.Entries[len(page.Entries)-1].Id
+	}
+	return history.Replay(entries)
+}
+
+// respondWithGuestsAsOf answers for the guest list, or the arrived parties,
+// as they were at t, in JSON or in a negotiated export format.
+func (s *Post) respondWithGuestsAsOf(w http.ResponseWriter, r *http.Request, t time.Time, arrivedOnly bool,
+	filename string) {
+	plan, err := s.seatingAsOf(r.Context(), t)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var guests []models.GuestsReservation
+	for _, state := range plan.Reservations {
+		if arrivedOnly && state.Status != models.Attended ||
+			state.Status == models.Invited || state.Status == models.Declined || state.Status == models.Cancelled {
+			continue
+		}
+		guests = append(guests, state.Reservation())
+	}
+
+	byName := func(fn func(models.GuestsReservation) error) error {
+		sorted := append([]models.GuestsReservation(nil), guests...)
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+		for _, guest := range sorted {
+			if err := fn(guest); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if s.exportGuests(w, r, byName, filename) {
+		return
+	}
+
+	// The JSON has the same fields as the live lists.
+	list := make([]models.GuestsReservation, len(guests))
+	for i, g := range guests {
+		if arrivedOnly {
+			list[i] = models.GuestsReservation{Name: g.Name, AccompanyingGuests: g.AccompanyingGuests,
+				ArrivalTime: g.ArrivalTime}
+		} else {
+			list[i] = models.GuestsReservation{Id: g.Id, TableId: g.TableId, TableGroupId: g.TableGroupId, Name: g.Name,
+				AccompanyingGuests: g.AccompanyingGuests, Tables: g.Tables}
+		}
+	}
+	if len(list) == 0 {
+		list = nil
+	}
+	models.RespondwithJSON(w, http.StatusOK, models.GuestList{Guests: list})
+}
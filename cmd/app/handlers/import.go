@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"github.com/getground/tech-tasks/backend/cmd/app/guestcsv"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"log"
+	"net/http"
+)
+
+const maxImportSize = 10 << 20
+
+// ImportGuestsList books every reservation of a CSV guest list, or none of
+// them if any row is invalid or does not fit.
+func (s *Post) ImportGuestsList(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	rows, rowErrors, err := guestcsv.Parse(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		models.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(rowErrors) == 0 {
+		rowErrors, err = s.repo.ImportReservations(r.Context(), rows)
+		if err != nil {
+			models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if len(rowErrors) > 0 {
+		log.Printf("Guest list import rejected with %v errors", len(rowErrors))
+		models.RespondwithJSON(w, http.StatusUnprocessableEntity, models.ImportResult{Errors: rowErrors})
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, models.ImportResult{Imported: len(rows)})
+}
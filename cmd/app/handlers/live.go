@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"github.com/getground/tech-tasks/backend/cmd/app/live"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// heartbeatInterval keeps idle streams from being closed by proxies.
+const heartbeatInterval = 15 * time.Second
+
+// SetLive streams the changes committed through the handlers to hub.
+func (s *Post) SetLive(hub *live.Hub) {
+	s.live = hub
+	s.repo.OnCommit(hub.Notify)
+}
+
+// SetStreamLimit ends every live stream after limit, so that it is over before
+// the write timeout of the server cuts it off; clients reconnect with
+// Last-Event-ID and miss nothing. 0 is no limit.
+func (s *Post) SetStreamLimit(limit time.Duration) {
+	s.streamLimit = limit
+}
+
+// StreamLiveUpdates sends arrivals, departures, new reservations and the other
+// changes of occupancy as server-sent events the moment they are committed,
+// each followed by the number of empty seats. Every change has the audit log
+// id as its event id; a client reconnecting with Last-Event-ID (or
+// ?last_event_id=) first receives what it missed.
+func (s *Post) StreamLiveUpdates(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || s.live == nil {
+		models.RespondWithError(w, http.StatusServiceUnavailable, "Live updates are not available")
+		return
+	}
+	lastId := r.Header.Get("Last-Event-ID")
+	if lastId == "" {
+		lastId = r.URL.Query().Get("last_event_id")
+	}
+	var afterId int64
+	if lastId != "" {
+		var err error
+		if afterId, err = strconv.ParseInt(lastId, 10, 64); err != nil || afterId < 0 {
+			models.RespondWithError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+	}
+
+	// Subscribing before replaying means no change falls between the two; the
+	// ones seen twice are skipped.
+	sub := s.live.Subscribe()
+	defer s.live.Unsubscribe(sub)
+	ctx := r.Context()
+	replayed := map[int64]bool{}
+	var missed []live.Message
+	if afterId > 0 {
+		err := s.live.Replay(ctx, afterId, func(msg live.Message) error {
+			replayed[msg.Id] = true
+			missed = append(missed, msg)
+			return nil
+		})
+		if err != nil {
+			models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	seats, err := s.live.Seats()
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, msg := range append(missed, seats) {
+		if msg.Encode(w) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	var limit <-chan time.Time
+	if s.streamLimit > 0 {
+		timer := time.NewTimer(s.streamLimit)
+		defer timer.Stop()
+		limit = timer.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-limit:
+			return
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": ping\n\n")); err != nil {
+				return
+			}
+		case msg, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if replayed[msg.Id] {
+				continue
+			}
+			if msg.Encode(w) != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
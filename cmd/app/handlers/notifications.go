@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"strconv"
+)
+
+// GetNotifications is the log of the notifications sent, waiting to be sent
+// or given up, optionally only those of ?reservation_id=.
+func (s *Post) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	var reservationId int64
+	if v := r.URL.Query().Get("reservation_id"); v != "" {
+		var err error
+		if reservationId, err = strconv.ParseInt(v, 10, 64); err != nil || reservationId <= 0 {
+			models.RespondWithError(w, http.StatusBadRequest, "Invalid reservation_id")
+			return
+		}
+	}
+	notifications, err:= s.repo.GetNotifications(r.Context(), reservationId)
+	if err!=nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, notifications)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+// The portal handlers are reached by guests rather than staff. The token in
+// the path is the only credential and scopes every call to one reservation.
+
+func (s *Post) GetOwnReservation(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	reservation, err:= s.repo.GetReservationByToken(r.Context(), params["token"])
+	if err!=nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, reservation)
+}
+
+func (s *Post) ChangeOwnPartySize(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	var change models.PortalReservation
+	err := json.NewDecoder(r.Body).Decode(&change)
+	if err != nil {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	if change.AccompanyingGuests <= 0 {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid guest number")
+		return
+	}
+
+	err = s.repo.ChangePartySize(r.Context(), params["token"], change.AccompanyingGuests)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	s.GetOwnReservation(w, r)
+}
+
+func (s *Post) UpdateOwnDietaryRequirements(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	var dietary models.PortalReservation
+	err := json.NewDecoder(r.Body).Decode(&dietary)
+	if err != nil {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	if !dietary.Diet.Valid() || len(dietary.DietaryNeeds) > 255 {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid dietary requirements")
+		log.Printf("Invalid diet %q", dietary.Diet)
+		return
+	}
+
+	err = s.repo.UpdateDietaryRequirements(r.Context(), params["token"], &dietary)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	s.GetOwnReservation(w, r)
+}
+
+func (s *Post) CancelOwnReservation(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	err := s.repo.CancelReservation(r.Context(), params["token"])
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
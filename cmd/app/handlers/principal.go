@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"github.com/getground/tech-tasks/backend/cmd/app/auth"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+)
+
+// GetPrincipal tells who the request was authenticated as. With
+// authentication off the method is "none".
+func (s *Post) GetPrincipal(w http.ResponseWriter, r *http.Request) {
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		p = auth.Principal{Method: "none"}
+	}
+	models.RespondwithJSON(w, http.StatusOK, p)
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+// respondWithRepoError maps the repository errors a caller can act upon to
+// their status codes, anything else is a server error.
+func respondWithRepoError(w http.ResponseWriter, err error) {
+	switch {
+	case isAny(err, repository.ErrNoSuchMember, repository.ErrNoSuchInvitation, repository.ErrUnknownToken,
+		repository.ErrUnknownCode, repository.ErrNoSuchWebhook):
+		models.RespondWithError(w, http.StatusNotFound, err.Error())
+	case isAny(err, repository.ErrInvitationClosed, repository.ErrReservationClosed, repository.ErrAlreadyCheckedIn,
+		repository.ErrNotEnoughSeats, repository.ErrRosterTooLarge):
+		models.RespondWithError(w, http.StatusConflict, err.Error())
+	case isAny(err, repository.ErrNoTableChosen):
+		models.RespondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// isAny tells whether err is, or wraps, one of targets.
+func isAny(err error, targets ...error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Post) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	invitation:= models.GuestsReservation{Name: params["name"]}
+	err := json.NewDecoder(r.Body).Decode(&invitation)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		log.Println("There was an error decoding the request body into the struct")
+		return
+	}
+	defer r.Body.Close()
+
+	if invitation.AccompanyingGuests <= 0 || !invitation.Diet.Valid() || !models.ValidEmail(invitation.Email) {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid invitation")
+		log.Printf("Invalid invitation for %s", invitation.Name)
+		return
+	}
+	if invitation.TableId == 0 && invitation.TableGroupId == 0 {
+		models.RespondWithError(w, http.StatusBadRequest, "An invitation needs a table_id or a table_group_id")
+		return
+	}
+
+	err = s.repo.CreateInvitation(r.Context(), &invitation)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, invitation)
+}
+
+func (s *Post) GetInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err:= s.repo.GetInvitations(r.Context())
+	if err!=nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, invitations)
+}
+
+func (s *Post) GetRsvp(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	invitation, err:= s.repo.GetInvitation(r.Context(), params["token"])
+	if err!=nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, invitation)
+}
+
+func (s *Post) AcceptRsvp(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	var answer models.GuestsReservation
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&answer)
+		if err != nil {
+			models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			log.Println("There was an error decoding the request body into the struct")
+			return
+		}
+		defer r.Body.Close()
+		if answer.AccompanyingGuests <= 0 {
+			models.RespondWithError(w, http.StatusBadRequest, "Invalid guest number")
+			return
+		}
+	}
+
+	err := s.repo.AcceptInvitation(r.Context(), params["token"], &answer)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, answer)
+}
+
+func (s *Post) DeclineRsvp(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	err := s.repo.DeclineInvitation(r.Context(), params["token"])
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Post) ChangeRsvp(w http.ResponseWriter, r *http.Request) {
+	params:= mux.Vars(r)
+	var answer models.GuestsReservation
+	err := json.NewDecoder(r.Body).Decode(&answer)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		log.Println("There was an error decoding the request body into the struct")
+		return
+	}
+	defer r.Body.Close()
+
+	if answer.AccompanyingGuests <= 0 {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid guest number")
+		return
+	}
+
+	err = s.repo.ChangeInvitation(r.Context(), params["token"], answer.AccompanyingGuests)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
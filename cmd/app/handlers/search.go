@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/search"
+	"net/http"
+	"strings"
+)
+
+const maxSearchMatches = 10
+
+// SearchGuests finds reservations from a partial or misspelt name typed at
+// the check-in desk, best matches first.
+func (s *Post) SearchGuests(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		models.RespondWithError(w, http.StatusBadRequest, "Missing search query")
+		return
+	}
+
+	candidates, err := s.repo.GetReservationsForLookup(r.Context())
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	names := make([]string, len(candidates))
+	for i, c := range candidates {
+		names[i] = c.Name
+	}
+
+	results := models.SearchResults{Matches: []models.SearchMatch{}}
+	for _, match := range search.Rank(query, names, maxSearchMatches) {
+		results.Matches = append(results.Matches, models.SearchMatch{
+			Score:             match.Score,
+			GuestsReservation: candidates[match.Index],
+		})
+	}
+	models.RespondwithJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+)
+
+// CheckSeats reports where the seat counters on tables, or the seats held by
+// reservations, differ from what the reservations say they should be.
+func (s *Post) CheckSeats(w http.ResponseWriter, r *http.Request) {
+	report, err:= s.repo.CheckSeats(r.Context())
+	if err!=nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, report)
+}
+
+// RepairSeats fixes every discrepancy CheckSeats finds, or nothing at all when
+// one of them cannot be fixed.
+func (s *Post) RepairSeats(w http.ResponseWriter, r *http.Request) {
+	report, err:= s.repo.RepairSeats(r.Context())
+	if err!=nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(report.Errors) > 0 {
+		models.RespondwithJSON(w, http.StatusConflict, report)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, report)
+}
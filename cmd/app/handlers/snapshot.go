@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/snapshot"
+	"log"
+	"net/http"
+	"time"
+)
+
+const maxSnapshotSize = 64 << 20
+
+func (s *Post) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	state, err:= s.repo.GetSnapshot(r.Context())
+	if err!=nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	state.Version = snapshot.Version
+	state.CreatedAt = time.Now().UTC()
+	w.Header().Set("Content-Disposition", `attachment; filename="snapshot.json"`)
+	models.RespondwithJSON(w, http.StatusOK, state)
+}
+
+// RestoreSnapshot loads a snapshot taken by GetSnapshot, after checking that
+// it is consistent. ?mode=replace swaps the current state for it, ?mode=merge
+// adds it next to the current state.
+func (s *Post) RestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode != "replace" && mode != "merge" {
+		models.RespondWithError(w, http.StatusBadRequest, "mode must be replace or merge")
+		return
+	}
+
+	var state models.Snapshot
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSnapshotSize)).Decode(&state)
+	if err != nil {
+		models.RespondWithError(w, http.StatusBadRequest, err.Error())
+		log.Println("There was an error decoding the request body into the struct")
+		return
+	}
+	defer r.Body.Close()
+
+	if problems := snapshot.Validate(&state); len(problems) > 0 {
+		log.Printf("Snapshot refused with %v problems", len(problems))
+		models.RespondwithJSON(w, http.StatusUnprocessableEntity, models.SnapshotReport{Mode: mode, Errors: problems})
+		return
+	}
+	snapshot.Upgrade(&state)
+	report, err := s.repo.RestoreSnapshot(r.Context(), &state, mode == "merge")
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(report.Errors) > 0 {
+		models.RespondwithJSON(w, http.StatusConflict, report)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, report)
+}
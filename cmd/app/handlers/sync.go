@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/guestcsv"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// SyncGuestsList makes the guest list match the full list in the body, given
+// as CSV or as JSON {"guests": [...]}. With ?dry_run=true the differences are
+// only shown.
+func (s *Post) SyncGuestsList(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			models.RespondWithError(w, http.StatusBadRequest, "Invalid dry_run")
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	var rows []models.ImportRow
+	var rowErrors []models.RowError
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		var err error
+		if rows, rowErrors, err = guestcsv.Parse(body); err != nil {
+			models.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		var list models.GuestList
+		if err := json.NewDecoder(body).Decode(&list); err != nil {
+			models.RespondWithError(w, http.StatusBadRequest, err.Error())
+			log.Println("There was an error decoding the request body into the struct")
+			return
+		}
+		rows, rowErrors = guestcsv.CheckRows(list.Guests)
+	}
+	if len(rowErrors) > 0 {
+		models.RespondwithJSON(w, http.StatusUnprocessableEntity, models.SyncResult{DryRun: dryRun, Errors: rowErrors})
+		return
+	}
+
+	result, err := s.repo.SyncGuestList(r.Context(), rows, dryRun)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(result.Errors) > 0 {
+		log.Printf("Guest list sync rejected with %v errors", len(result.Errors))
+		models.RespondwithJSON(w, http.StatusUnprocessableEntity, result)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CreateWebhook subscribes a URL to one kind of change. The response shows the
+// secret the payloads are signed with; it is not shown again.
+func (s *Post) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhook models.Webhook
+	err := json.NewDecoder(r.Body).Decode(&webhook)
+	if err != nil {
+		models.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		models.RespondWithError(w, http.StatusBadRequest, "A webhook needs an http or https url")
+		log.Printf("Invalid webhook url %q", webhook.URL)
+		return
+	}
+	if !validWebhookEvent(webhook.EventType) {
+		models.RespondWithError(w, http.StatusBadRequest,
+			"event_type must be one of "+strings.Join(models.WebhookEvents, ", "))
+		return
+	}
+
+	err = s.repo.CreateWebhook(r.Context(), &webhook)
+	if err != nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, webhook)
+}
+
+func validWebhookEvent(event string) bool {
+	for _, e := range models.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Post) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err:= s.repo.GetWebhooks(r.Context())
+	if err!=nil {
+		models.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, webhooks)
+}
+
+func (s *Post) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookId(w, r)
+	if !ok {
+		return
+	}
+	if err := s.repo.DeleteWebhook(r.Context(), id); err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries lists every attempt to deliver to a webhook, oldest
+// first.
+func (s *Post) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookId(w, r)
+	if !ok {
+		return
+	}
+	deliveries, err := s.repo.GetWebhookDeliveries(r.Context(), id)
+	if err != nil {
+		respondWithRepoError(w, err)
+		return
+	}
+	models.RespondwithJSON(w, http.StatusOK, deliveries)
+}
+
+func webhookId(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		models.RespondWithError(w, http.StatusBadRequest, "Invalid webhook id")
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,147 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrNotChecked is the state before the first check.
+var ErrNotChecked = errors.New("not checked yet")
+
+// pingTimeout bounds a single check, so a database that does not answer
+// counts as down rather than holding the check.
+const pingTimeout = 5 * time.Second
+
+// Pinger is what is checked; *sql.DB is one.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Retry is how the database is waited for: the delay starts at Initial and
+// doubles up to Max, each randomly shortened by up to half so that instances
+// started together do not retry in step. Timeout ends the waiting, 0 waits
+// for ever.
+type Retry struct {
+	Initial time.Duration
+	Max     time.Duration
+	Timeout time.Duration
+}
+
+var (
+	jitterMu sync.Mutex
+	jitter   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Delay is how long to wait after the given failed attempt.
+func (r Retry) Delay(attempt int) time.Duration {
+	d := r.Initial
+	for i := 1; i < attempt && d < r.Max; i++ {
+		d *= 2
+	}
+	if d > r.Max {
+		d = r.Max
+	}
+	if d <= 1 {
+		return d
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return d - time.Duration(jitter.Int63n(int64(d/2)+1))
+}
+
+// Wait checks p until it answers, waiting between the attempts as r says, and
+// returns the last error when r.Timeout or ctx runs out first.
+func Wait(ctx context.Context, p Pinger, r Retry) error {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	for attempt := 1; ; attempt++ {
+		err := ping(ctx, p)
+		if err == nil {
+			return nil
+		}
+		delay := r.Delay(attempt)
+		log.Printf("database is not available (attempt %d), retrying in %v: %v", attempt, delay.Round(time.Millisecond),
+			err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting for the database after %d attempts: %v", attempt, err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+func ping(ctx context.Context, p Pinger) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	return p.PingContext(ctx)
+}
+
+// Checker keeps track of whether the database is available. The connection
+// pool reconnects by itself once the database is back; the Checker notices
+// and reports the service ready again.
+type Checker struct {
+	pinger Pinger
+	retry  Retry
+
+	mu  sync.RWMutex
+	err error
+}
+
+// NewChecker checks p. It is not ready until its first check succeeds.
+func NewChecker(p Pinger, r Retry) *Checker {
+	return &Checker{pinger: p, retry: r, err: ErrNotChecked}
+}
+
+// Ready returns nil when the database answered the last check, otherwise why
+// it did not.
+func (c *Checker) Ready() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.err
+}
+
+// Check checks the database once and records the outcome.
+func (c *Checker) Check(ctx context.Context) error {
+	err := ping(ctx, c.pinger)
+	c.mu.Lock()
+	was := c.err
+	c.err = err
+	c.mu.Unlock()
+	switch {
+	case err != nil && was == nil:
+		log.Printf("database went away, not ready: %v", err)
+	case err == nil && was != nil && was != ErrNotChecked:
+		log.Println("database is back, ready")
+	}
+	return err
+}
+
+// Run checks the database every interval until ctx is done, and while it is
+// down as often as the retry delays allow.
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	failed := 0
+	for {
+		wait := interval
+		if err := c.Check(ctx); err != nil {
+			failed++
+			if d := c.retry.Delay(failed); d < interval {
+				wait = d
+			}
+		} else {
+			failed = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
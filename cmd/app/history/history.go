@@ -0,0 +1,70 @@
+// Package history rebuilds the seating plan as it was at a past moment by
+// replaying the audit log.
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"sort"
+)
+
+// Replay applies audit entries, oldest first, and returns the tables and
+// reservations as they were after the last one. Seat counters are derived
+// from the seats each reservation held, as the database does.
+//
+// Only what the log recorded can be rebuilt: changes made before the audit
+// log existed are missing, and so are the seat positions chosen within a
+// table.
+func Replay(entries []models.AuditEntry) (*models.SeatingPlan, error) {
+	capacities := map[int64]int{}
+	reservations := map[int64]models.ReservationState{}
+
+	for _, e := range entries {
+		switch {
+		case e.Action == models.AuditTableCreated || e.Action == models.AuditTableRestored:
+			var t models.Table
+			if err := json.Unmarshal(e.After, &t); err != nil {
+				return nil, fmt.Errorf("audit entry %d: %v", e.Id, err)
+			}
+			capacities[t.Id] = t.Capacity
+		case e.Action == models.AuditSnapshotRestored:
+			var report models.SnapshotReport
+			if err := json.Unmarshal(e.After, &report); err != nil {
+				return nil, fmt.Errorf("audit entry %d: %v", e.Id, err)
+			}
+			// A replace starts over; the restored tables and reservations
+			// follow in the next entries.
+			if report.Mode == "replace" {
+				capacities = map[int64]int{}
+				reservations = map[int64]models.ReservationState{}
+			}
+		case e.Action == models.AuditSeatsAssigned:
+			// Seats only change position within the tables the party holds.
+		case e.ReservationId != 0 && len(e.After) > 0:
+			var r models.ReservationState
+			if err := json.Unmarshal(e.After, &r); err != nil {
+				return nil, fmt.Errorf("audit entry %d: %v", e.Id, err)
+			}
+			reservations[e.ReservationId] = r
+		}
+	}
+
+	booked := map[int64]int{}
+	plan := &models.SeatingPlan{Reservations: []models.ReservationState{}}
+	for _, r := range reservations {
+		if r.Status.HoldsSeats() {
+			for _, a := range r.Tables {
+				booked[int64(a.TableId)] += int(a.Seats)
+			}
+		}
+		plan.Reservations = append(plan.Reservations, r)
+	}
+	sort.Slice(plan.Reservations, func(i, j int) bool { return plan.Reservations[i].Id < plan.Reservations[j].Id })
+	for id, capacity := range capacities {
+		plan.Tables = append(plan.Tables, models.Table{Id: id, Capacity: capacity, BookedSeats: booked[id],
+			AvailableSeats: capacity - booked[id]})
+	}
+	sort.Slice(plan.Tables, func(i, j int) bool { return plan.Tables[i].Id < plan.Tables[j].Id })
+	return plan, nil
+}
@@ -0,0 +1,94 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	dateTimeLayout = "20060102T150405Z"
+	maxLineOctets  = 75
+)
+
+// Status values of an event.
+const (
+	Confirmed = "CONFIRMED"
+	Tentative = "TENTATIVE"
+	Cancelled = "CANCELLED"
+)
+
+// Event is one VEVENT of a calendar.
+type Event struct {
+	UID         string
+	Summary     string
+	Location    string
+	Description string
+	Start       time.Time
+	End         time.Time
+	Status      string
+}
+
+// Write writes a calendar holding events. now is used as the time stamp of
+// every event.
+func Write(w io.Writer, events []Event, now time.Time) error {
+	b := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(b, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//getground//guest list//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	for _, e := range events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(e.UID))
+		line("DTSTAMP", now.UTC().Format(dateTimeLayout))
+		line("DTSTART", e.Start.UTC().Format(dateTimeLayout))
+		if !e.End.IsZero() {
+			line("DTEND", e.End.UTC().Format(dateTimeLayout))
+		}
+		line("SUMMARY", escape(e.Summary))
+		if e.Location != "" {
+			line("LOCATION", escape(e.Location))
+		}
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		if e.Status != "" {
+			line("STATUS", e.Status)
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return b.Flush()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// escape makes text safe for a TEXT property value.
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// writeFolded ends a content line with CRLF, folding it so that no line is
+// longer than 75 octets and no UTF-8 sequence is split.
+func writeFolded(b *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space of a continuation line counts towards its length.
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,289 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	pageSize = 1000
+	// pollInterval is how often the audit log is read without being told
+	// about a change, to pick up changes made by other processes.
+	pollInterval = 2 * time.Second
+	// gapWait is how long an audit log id that was skipped is waited for: a
+	// transaction that started earlier may commit after a later one.
+	gapWait = 5 * time.Second
+	maxGap  = 100
+	// bufferSize is how many messages a subscriber may fall behind before it
+	// is dropped; it then reconnects and resumes from the audit log.
+	bufferSize = 64
+)
+
+// SeatsEvent is the event carrying the number of empty seats.
+const SeatsEvent = "seats"
+
+// Source is where the Hub reads the changes from.
+type Source interface {
+	GetAuditLog(ctx context.Context, filter models.AuditFilter) (*models.AuditLog, error)
+	LatestAuditId(ctx context.Context) (int64, error)
+	GetEmptySeats() (*models.Seats, error)
+}
+
+// Message is one server-sent event. Id is the audit log id of the change, 0
+// for the seat count, which is always sent as it is now.
+type Message struct {
+	Id    int64
+	Event string
+	Data  []byte
+}
+
+// Encode writes m in the text/event-stream format.
+func (m Message) Encode(w io.Writer) error {
+	var err error
+	if m.Id != 0 {
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", m.Id, m.Event, m.Data)
+	} else {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", m.Event, m.Data)
+	}
+	return err
+}
+
+// Update turns an audit log entry into the message streamed for it; false
+// for the changes that are not streamed.
+func Update(e models.AuditEntry) (Message, bool) {
+	if !streamed(e.Action) || e.After == nil {
+		return Message{}, false
+	}
+	var state models.ReservationState
+	if err := json.Unmarshal(e.After, &state); err != nil {
+		log.Printf("audit log entry id=%v cannot be streamed: %v", e.Id, err)
+		return Message{}, false
+	}
+	data, err := json.Marshal(models.LiveUpdate{Id: e.Id, Action: e.Action, OccurredAt: e.OccurredAt,
+		Reservation: state.Reservation()})
+	if err != nil {
+		return Message{}, false
+	}
+	return Message{Id: e.Id, Event: e.Action, Data: data}, true
+}
+
+func streamed(action string) bool {
+	for _, a := range models.LiveEvents {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func seatsMessage(seats *models.Seats) Message {
+	data, _ := json.Marshal(seats)
+	return Message{Event: SeatsEvent, Data: data}
+}
+
+// Subscription receives the messages of a Hub on C, which is closed when the
+// subscriber fell too far behind or the hub stopped.
+type Subscription struct {
+	C <-chan Message
+	c chan Message
+}
+
+// Hub follows the audit log and passes every streamed change, and the seat
+// count after it, to its subscribers.
+type Hub struct {
+	source Source
+	wake   chan struct{}
+
+	// last and missing are only used by the goroutine started by Start.
+	last    int64
+	missing map[int64]time.Time
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]bool
+}
+
+func NewHub(source Source) *Hub {
+	return &Hub{
+		source:      source,
+		wake:        make(chan struct{}, 1),
+		missing:     map[int64]time.Time{},
+		subscribers: map[*Subscription]bool{},
+	}
+}
+
+// Notify tells the hub that a change was committed. It never blocks.
+func (h *Hub) Notify() {
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start streams the changes made from now on until ctx is done.
+func (h *Hub) Start(ctx context.Context) error {
+	last, err := h.source.LatestAuditId(ctx)
+	if err != nil {
+		return err
+	}
+	h.last = last
+	go h.run(ctx)
+	return nil
+}
+
+func (h *Hub) run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			h.closeAll()
+			return
+		case <-h.wake:
+		case <-ticker.C:
+		}
+		if err := h.poll(ctx); err != nil {
+			log.Printf("live updates failed: %v", err)
+		}
+	}
+}
+
+// poll reads the audit log entries not seen yet, including those whose ids
+// were skipped a moment ago, and publishes them.
+func (h *Hub) poll(ctx context.Context) error {
+	now := time.Now()
+	from := h.last
+	for id := range h.missing {
+		if id-1 < from {
+			from = id - 1
+		}
+	}
+
+	var messages []Message
+	changed := false
+	for {
+		page, err := h.source.GetAuditLog(ctx, models.AuditFilter{AfterId: from, Limit: pageSize})
+		if err != nil {
+			return err
+		}
+		for _, e := range page.Entries {
+			if e.Id <= h.last {
+				if _, ok := h.missing[e.Id]; !ok {
+					continue
+				}
+				delete(h.missing, e.Id)
+			} else {
+				if e.Id-h.last-1 <= maxGap {
+					for id := h.last + 1; id < e.Id; id++ {
+						h.missing[id] = now.Add(gapWait)
+					}
+				}
+				h.last = e.Id
+			}
+			changed = true
+			if msg, ok := Update(e); ok {
+				messages = append(messages, msg)
+			}
+		}
+		if len(page.Entries) < pageSize {
+			break
+		}
+		from = page.Entries[len(page.Entries)-1].Id
+	}
+	for id, until := range h.missing {
+		if now.After(until) {
+			delete(h.missing, id)
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	seats, err := h.source.GetEmptySeats()
+	if err != nil {
+		return err
+	}
+	h.publish(append(messages, seatsMessage(seats)))
+	return nil
+}
+
+func (h *Hub) publish(messages []Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		for _, msg := range messages {
+			select {
+			case sub.c <- msg:
+				continue
+			default:
+			}
+			delete(h.subscribers, sub)
+			close(sub.c)
+			break
+		}
+	}
+}
+
+func (h *Hub) Subscribe() *Subscription {
+	c := make(chan Message, bufferSize)
+	sub := &Subscription{C: c, c: c}
+	h.mu.Lock()
+	h.subscribers[sub] = true
+	h.mu.Unlock()
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[sub] {
+		delete(h.subscribers, sub)
+		close(sub.c)
+	}
+}
+
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		delete(h.subscribers, sub)
+		close(sub.c)
+	}
+}
+
+// Replay passes the streamed changes after the audit log id afterId to fn,
+// oldest first, so that a subscriber can resume where it left off.
+func (h *Hub) Replay(ctx context.Context, afterId int64, fn func(Message) error) error {
+	filter := models.AuditFilter{AfterId: afterId, Limit: pageSize}
+	for {
+		page, err := h.source.GetAuditLog(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, e := range page.Entries {
+			if msg, ok := Update(e); ok {
+				if err := fn(msg); err != nil {
+					return err
+				}
+			}
+		}
+		if len(page.Entries) < pageSize {
+			return nil
+		}
+		filter.AfterId = page.Entries[len(page.Entries)-1].Id
+	}
+}
+
+// Seats returns the message with the number of empty seats now.
+func (h *Hub) Seats() (Message, error) {
+	seats, err := h.source.GetEmptySeats()
+	if err != nil {
+		return Message{}, err
+	}
+	return seatsMessage(seats), nil
+}
@@ -4,9 +4,17 @@ import (
 	"github.com/getground/tech-tasks/backend/cmd/app/server"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/joho/godotenv/autoload"
+	"log"
+	"os"
+	"strings"
 )
 
 func main() {
-	api.Run()
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := api.RunCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	api.Run(os.Args[1:])
 }
-
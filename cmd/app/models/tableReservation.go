@@ -1,7 +1,10 @@
 package models
 
 import (
+	"encoding/json"
+	"net/mail"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -9,9 +12,67 @@ const (
 	Upcoming       	Status = 0
 	Attended 		Status = 1
 	Archived       	Status = 2
+	Invited			Status = 3
+	Declined		Status = 4
+	Cancelled		Status = 5
 )
+
+const (
+	NoDiet			Diet = ""
+	Vegetarian		Diet = "vegetarian"
+	Vegan			Diet = "vegan"
+)
+
+const (
+	Adult			AgeGroup = "adult"
+	Child			AgeGroup = "child"
+	Infant			AgeGroup = "infant"
+)
+// Actions recorded in the audit log.
+const (
+	AuditTableCreated			= "table.created"
+	AuditTableRestored			= "table.restored"
+	AuditTableGroupCreated		= "table_group.created"
+	AuditReservationCreated		= "reservation.created"
+	AuditInvited				= "reservation.invited"
+	AuditAccepted				= "reservation.accepted"
+	AuditDeclined				= "reservation.declined"
+	AuditArrived				= "reservation.arrived"
+	AuditLeft					= "reservation.left"
+	AuditCancelled				= "reservation.cancelled"
+	AuditResized				= "reservation.resized"
+	AuditMoved					= "reservation.moved"
+	AuditSynced					= "reservation.synced"
+	AuditSeatsAssigned			= "reservation.seats_assigned"
+	AuditDietaryUpdated			= "reservation.dietary_updated"
+	AuditMemberAdded			= "reservation.member_added"
+	AuditMemberUpdated			= "reservation.member_updated"
+	AuditMemberRemoved			= "reservation.member_removed"
+	AuditRestored				= "reservation.restored"
+	AuditSnapshotRestored		= "snapshot.restored"
+	AuditSeatsRepaired			= "seats.repaired"
+)
+
+// WebhookEvents are the changes a webhook can subscribe to.
+var WebhookEvents = []string{AuditReservationCreated, AuditAccepted, AuditDeclined, AuditArrived, AuditLeft,
+	AuditCancelled, AuditResized, AuditMoved}
+
+// Kinds of notification sent to guests.
+const (
+	NotifyBookingConfirmed	= "booking_confirmed"
+	NotifyTableChanged		= "table_changed"
+	NotifyReminder			= "reminder"
+	NotifyWaitlistPromoted	= "waitlist_promoted"
+)
+
+// LiveEvents are the changes streamed to the staff screens as they happen.
+var LiveEvents = []string{AuditReservationCreated, AuditAccepted, AuditArrived, AuditLeft, AuditCancelled,
+	AuditResized, AuditMoved}
+
 type (
 	Status      			int
+	AgeGroup				string
+	Diet					string
 	timestamp 				uint64
 	Table struct {
 		Id 					int64 			`json:"id"`
@@ -26,6 +87,65 @@ type (
 		Status				Status			`json:"status"`
 		Name				string			`json:"name"`
 		ArrivalTime       	timestamp		`json:"time_arrived"`
+		TableGroupId		int64			`json:"table_group_id,omitempty"`
+		Tables				[]SeatAllocation	`json:"tables,omitempty"`
+		RsvpToken			string			`json:"rsvp_token,omitempty"`
+		ConfirmationCode	string			`json:"confirmation_code,omitempty"`
+		DietaryNeeds		string			`json:"dietary_needs,omitempty"`
+		Email				string			`json:"email,omitempty"`
+		DietaryRequirements
+	}
+	// DietaryRequirements are what the caterers need to know about one guest.
+	DietaryRequirements struct {
+		Diet				Diet			`json:"diet,omitempty"`
+		GlutenFree			bool			`json:"gluten_free,omitempty"`
+		NutAllergy			bool			`json:"nut_allergy,omitempty"`
+	}
+	CateringCounts struct {
+		Vegetarian			int64			`json:"vegetarian"`
+		Vegan				int64			`json:"vegan"`
+		GlutenFree			int64			`json:"gluten_free"`
+		NutAllergy			int64			`json:"nut_allergy"`
+	}
+	TableCatering struct {
+		TableId				int32			`json:"table_id"`
+		CateringCounts
+	}
+	CateringReport struct {
+		Tables				[]TableCatering	`json:"tables"`
+		Total				CateringCounts	`json:"total"`
+	}
+	SeatAllocation struct {
+		TableId				int32			`json:"table_id"`
+		Seats				int64			`json:"seats"`
+	}
+	Seat struct {
+		Id					int64			`json:"id"`
+		TableId				int32			`json:"table_id"`
+		Position			int				`json:"position"`
+		ReservationId		int64			`json:"reservation_id,omitempty"`
+		Guest				*int			`json:"guest,omitempty"`
+	}
+	SeatList struct {
+		Seats				[]Seat			`json:"seats"`
+	}
+	// SeatAssignment places one member of a party on a specific seat. Guest 0
+	// is the main guest, the accompanying guests follow from 1.
+	SeatAssignment struct {
+		TableId				int32			`json:"table_id"`
+		Position			int				`json:"position"`
+		Guest				int				`json:"guest"`
+	}
+	SeatAssignmentList struct {
+		Assignments			[]SeatAssignment	`json:"assignments"`
+	}
+	TableGroup struct {
+		Id					int64			`json:"id"`
+		Name				string			`json:"name"`
+		TableIds			[]int32			`json:"table_ids"`
+	}
+	TableGroupList struct {
+		Groups				[]TableGroup	`json:"groups"`
 	}
 	Seats struct {
 		SeatsEmpty 			int32 			`json:"seats_empty"`
@@ -33,19 +153,365 @@ type (
 	GuestList struct {
 		Guests 				[]GuestsReservation `json:"guests"`
 	}
+	// PartyMember is a named accompanying guest of a reservation.
+	PartyMember struct {
+		Id					int64			`json:"id"`
+		ReservationId		int64			`json:"reservation_id"`
+		Name				string			`json:"name"`
+		DietaryNeeds		string			`json:"dietary_needs"`
+		AgeGroup			AgeGroup		`json:"age_group"`
+		Accessibility		string			`json:"accessibility"`
+		DietaryRequirements
+	}
+	PartyMemberList struct {
+		Members				[]PartyMember	`json:"members"`
+	}
+	SearchMatch struct {
+		Score				float64			`json:"score"`
+		GuestsReservation
+	}
+	SearchResults struct {
+		Matches				[]SearchMatch	`json:"matches"`
+	}
+	// ImportRow is a reservation read from a file, with the row it came from.
+	ImportRow struct {
+		Row					int				`json:"row"`
+		GuestsReservation
+	}
+	// RowError is a problem found on one row of an imported file.
+	RowError struct {
+		Row					int				`json:"row"`
+		Name				string			`json:"name,omitempty"`
+		Message				string			`json:"message"`
+	}
+	ImportResult struct {
+		Imported			int				`json:"imported"`
+		Errors				[]RowError		`json:"errors,omitempty"`
+	}
+	// SyncParty is where a party sits and how large it is, before or after a
+	// sync.
+	SyncParty struct {
+		Name				string			`json:"name,omitempty"`
+		TableId				int32			`json:"table_id"`
+		TableGroupId		int64			`json:"table_group_id,omitempty"`
+		AccompanyingGuests	int64			`json:"accompanying_guests"`
+	}
+	SyncChange struct {
+		Name				string			`json:"name"`
+		Before				SyncParty		`json:"before"`
+		After				SyncParty		`json:"after"`
+	}
+	// SyncResult is the difference between the guest list and a desired list,
+	// either previewed or applied.
+	SyncResult struct {
+		DryRun				bool			`json:"dry_run"`
+		Added				[]SyncParty		`json:"added"`
+		Removed				[]SyncParty		`json:"removed"`
+		Changed				[]SyncChange	`json:"changed"`
+		Unchanged			int				`json:"unchanged"`
+		Errors				[]RowError		`json:"errors,omitempty"`
+	}
 	GuestDto struct {
 		Name 				string 			`json:"name"`
+		RsvpToken			string			`json:"rsvp_token,omitempty"`
+		ConfirmationCode	string			`json:"confirmation_code,omitempty"`
+	}
+	// PortalReservation is what a guest sees of their own reservation.
+	PortalReservation struct {
+		Id					int64			`json:"-"`
+		Name				string			`json:"name"`
+		ConfirmationCode	string			`json:"confirmation_code"`
+		TableId				int32			`json:"table_id,omitempty"`
+		AccompanyingGuests	int64			`json:"accompanying_guests"`
+		Status				Status			`json:"status"`
+		DietaryNeeds		string			`json:"dietary_needs"`
+		Tables				[]SeatAllocation	`json:"tables,omitempty"`
+		DietaryRequirements
+		Members				[]PartyMember	`json:"members"`
+	}
+	// Snapshot is the complete state of the seating plan, as exported for a
+	// backup or for another environment. Times are Unix seconds.
+	Snapshot struct {
+		Version				int				`json:"version"`
+		CreatedAt			time.Time		`json:"created_at"`
+		Tables				[]SnapshotTable	`json:"tables"`
+		TableGroups			[]TableGroup	`json:"table_groups"`
+		Reservations		[]SnapshotReservation	`json:"reservations"`
+	}
+	SnapshotTable struct {
+		Table
+		Seats				[]SnapshotSeat	`json:"seats"`
+	}
+	SnapshotSeat struct {
+		Position			int				`json:"position"`
+		ReservationId		int64			`json:"reservation_id,omitempty"`
+		Guest				*int			`json:"guest,omitempty"`
+	}
+	SnapshotReservation struct {
+		Id 					int64 			`json:"id"`
+		Name				string			`json:"name"`
+		TableId				int32			`json:"table_id"`
+		TableGroupId		int64			`json:"table_group_id,omitempty"`
+		AccompanyingGuests	int64			`json:"accompanying_guests"`
+		Status				Status			`json:"status"`
+		ArrivalTime			int64			`json:"arrival_time,omitempty"`
+		Token				string			`json:"token,omitempty"`
+		Invited				bool			`json:"invited,omitempty"`
+		ConfirmationCode	string			`json:"confirmation_code,omitempty"`
+		CheckInUsedAt		int64			`json:"checkin_used_at,omitempty"`
+		DietaryNeeds		string			`json:"dietary_needs,omitempty"`
+		Email				string			`json:"email,omitempty"`
+		DietaryRequirements
+		Tables				[]SeatAllocation	`json:"tables"`
+		Members				[]PartyMember	`json:"members"`
+	}
+	// SnapshotReport tells what a restore did, or why it was refused.
+	SnapshotReport struct {
+		Mode				string			`json:"mode"`
+		Tables				int				`json:"tables"`
+		Reservations		int				`json:"reservations"`
+		Errors				[]string		`json:"errors,omitempty"`
+	}
+	// SeatDiscrepancy is a stored count that differs from what the
+	// reservations say it should be.
+	SeatDiscrepancy struct {
+		TableId				int64			`json:"table_id,omitempty"`
+		ReservationId		int64			`json:"reservation_id,omitempty"`
+		Field				string			`json:"field"`
+		Expected			int64			`json:"expected"`
+		Actual				int64			`json:"actual"`
+	}
+	SeatCheckReport struct {
+		TablesChecked		int				`json:"tables_checked"`
+		ReservationsChecked	int				`json:"reservations_checked"`
+		Discrepancies		[]SeatDiscrepancy	`json:"discrepancies"`
+		Repaired			bool			`json:"repaired"`
+		Errors				[]string		`json:"errors,omitempty"`
+	}
+	// ReservationState is what the audit log records of a reservation before
+	// and after a change. ArrivalTime is in Unix seconds.
+	ReservationState struct {
+		Id 					int64 			`json:"id"`
+		Name				string			`json:"name"`
+		TableId				int32			`json:"table_id"`
+		TableGroupId		int64			`json:"table_group_id,omitempty"`
+		AccompanyingGuests	int64			`json:"accompanying_guests"`
+		Status				Status			`json:"status"`
+		ArrivalTime			int64			`json:"arrival_time,omitempty"`
+		ConfirmationCode	string			`json:"confirmation_code,omitempty"`
+		Tables				[]SeatAllocation	`json:"tables"`
+		DietaryNeeds		string			`json:"dietary_needs,omitempty"`
+		DietaryRequirements
+		Members				[]PartyMember	`json:"members,omitempty"`
+	}
+	// SeatingPlan is the tables and reservations as they were at a past
+	// moment, rebuilt from the audit log.
+	SeatingPlan struct {
+		Tables				[]Table
+		Reservations		[]ReservationState
+	}
+	// AuditEntry is one change, as written in the same transaction as the
+	// change itself. TableIds are all the tables it touched.
+	AuditEntry struct {
+		Id 					int64 			`json:"id"`
+		OccurredAt			timestamp		`json:"occurred_at"`
+		Actor				string			`json:"actor"`
+		Action				string			`json:"action"`
+		ReservationId		int64			`json:"reservation_id,omitempty"`
+		TableIds			[]int64			`json:"table_ids,omitempty"`
+		Before				json.RawMessage	`json:"before,omitempty"`
+		After				json.RawMessage	`json:"after,omitempty"`
+	}
+	AuditLog struct {
+		Entries				[]AuditEntry	`json:"entries"`
+	}
+	// AuditFilter selects audit entries; zero fields match everything. From
+	// and To bound the time of the change, both included.
+	AuditFilter struct {
+		ReservationId		int64
+		TableId				int64
+		From				time.Time
+		To					time.Time
+		AfterId				int64
+		Limit				int
+	}
+	// Webhook subscribes a URL to one kind of change. The secret signs the
+	// payloads and is only shown when the webhook is created.
+	Webhook struct {
+		Id					int64			`json:"id"`
+		URL					string			`json:"url"`
+		EventType			string			`json:"event_type"`
+		Secret				string			`json:"secret,omitempty"`
+	}
+	WebhookList struct {
+		Webhooks			[]Webhook		`json:"webhooks"`
+	}
+	// WebhookMessage is one payload waiting in the outbox to be delivered to
+	// one webhook.
+	WebhookMessage struct {
+		Id					int64
+		WebhookId			int64
+		URL					string
+		Secret				string
+		EventType			string
+		Payload				[]byte
+		Attempts			int
+	}
+	// WebhookPayload is the body sent to a webhook.
+	WebhookPayload struct {
+		EventType			string			`json:"event_type"`
+		OccurredAt			time.Time		`json:"occurred_at"`
+		Reservation			ReservationState	`json:"reservation"`
+	}
+	// WebhookDelivery is one attempt to deliver a message. StatusCode is 0
+	// when no response came back.
+	WebhookDelivery struct {
+		Id					int64			`json:"id"`
+		MessageId			int64			`json:"message_id"`
+		EventType			string			`json:"event_type"`
+		Attempt				int				`json:"attempt"`
+		AttemptedAt			timestamp		`json:"attempted_at"`
+		StatusCode			int				`json:"status_code"`
+		Error				string			`json:"error,omitempty"`
+		DurationMs			int64			`json:"duration_ms"`
+		Delivered			bool			`json:"delivered"`
+	}
+	WebhookDeliveryList struct {
+		Deliveries			[]WebhookDelivery	`json:"deliveries"`
+	}
+	// LiveUpdate is one change of a reservation as the live stream sends it.
+	LiveUpdate struct {
+		Id					int64				`json:"id"`
+		Action				string				`json:"action"`
+		OccurredAt			timestamp			`json:"occurred_at"`
+		Reservation			GuestsReservation	`json:"reservation"`
+	}
+	// NotificationData is what the notification templates are filled in with.
+	NotificationData struct {
+		Name				string			`json:"name"`
+		Tables				string			`json:"tables"`
+		PartySize			int64			`json:"party_size"`
+		ConfirmationCode	string			`json:"confirmation_code"`
+	}
+	// Notification is one message to a guest, waiting to be sent or already
+	// sent. Status is "pending", "sent" or "failed".
+	Notification struct {
+		Id					int64			`json:"id"`
+		ReservationId		int64			`json:"reservation_id"`
+		Kind				string			`json:"kind"`
+		Recipient			string			`json:"recipient"`
+		Data				NotificationData	`json:"-"`
+		Status				string			`json:"status"`
+		Attempts			int				`json:"attempts"`
+		CreatedAt			timestamp		`json:"created_at"`
+		SentAt				timestamp		`json:"sent_at,omitempty"`
+		LastError			string			`json:"last_error,omitempty"`
+	}
+	NotificationList struct {
+		Notifications		[]Notification	`json:"notifications"`
+	}
+	// Event is the occasion the reservations are for.
+	Event struct {
+		Name				string
+		Venue				string
+		Start				time.Time
+		End					time.Time
+		Domain				string
 	}
 )
 
 func GuestDtoFromEntity(guestEntity GuestsReservation) GuestDto {
-	return GuestDto{Name: guestEntity.Name}
+	return GuestDto{Name: guestEntity.Name, RsvpToken: guestEntity.RsvpToken, ConfirmationCode: guestEntity.ConfirmationCode}
+}
+
+// HoldsSeats reports whether a reservation in this status has seats booked.
+func (s Status) HoldsSeats() bool {
+	return s == Upcoming || s == Attended
+}
+
+// Reservation turns a recorded state back into a reservation as the guest
+// list shows it; the seats per table are only kept for a split party.
+func (s ReservationState) Reservation() GuestsReservation {
+	r := GuestsReservation{
+		Id:                  s.Id,
+		TableId:             s.TableId,
+		AccompanyingGuests:  s.AccompanyingGuests,
+		Status:              s.Status,
+		Name:                s.Name,
+		ArrivalTime:         timestamp(s.ArrivalTime),
+		TableGroupId:        s.TableGroupId,
+		ConfirmationCode:    s.ConfirmationCode,
+		DietaryNeeds:        s.DietaryNeeds,
+		DietaryRequirements: s.DietaryRequirements,
+	}
+	if len(s.Tables) > 1 {
+		r.Tables = s.Tables
+	}
+	return r
+}
+
+// TableNumbers lists every table a reservation sits at, e.g. "4+5" for a party
+// split across a table group. tables is empty for a party at one table.
+func TableNumbers(tableId int32, tables []SeatAllocation) string {
+	if len(tables) == 0 {
+		return strconv.FormatInt(int64(tableId), 10)
+	}
+	ids := make([]string, len(tables))
+	for i, t := range tables {
+		ids[i] = strconv.FormatInt(int64(t.TableId), 10)
+	}
+	return strings.Join(ids, "+")
+}
+
+// ValidEmail accepts an empty address, meaning the guest gets no
+// notifications, or a single plain address.
+func ValidEmail(email string) bool {
+	if email == "" {
+		return true
+	}
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && len(email) <= 255
+}
+
+func (d Diet) Valid() bool {
+	return d == NoDiet || d == Vegetarian || d == Vegan
+}
+
+func (c *CateringCounts) Add(o CateringCounts) {
+	c.Vegetarian += o.Vegetarian
+	c.Vegan += o.Vegan
+	c.GlutenFree += o.GlutenFree
+	c.NutAllergy += o.NutAllergy
+}
+
+// Count adds the meal of one person.
+func (c *CateringCounts) Count(d DietaryRequirements) {
+	if d.Diet == Vegetarian {
+		c.Vegetarian++
+	}
+	if d.Diet == Vegan {
+		c.Vegan++
+	}
+	if d.GlutenFree {
+		c.GlutenFree++
+	}
+	if d.NutAllergy {
+		c.NutAllergy++
+	}
+}
+
+func (a AgeGroup) Valid() bool {
+	return a == Adult || a == Child || a == Infant
 }
 
 func (ts timestamp) MarshalJSON() (data []byte, _ error) {
+		return strconv.AppendQuote(data, ts.String()), nil
+}
+
+// String formats the timestamp the way the JSON responses show it.
+func (ts timestamp) String() string {
 		layout := "2006-01-02 15:04:05"
-		x:= time.Unix(int64(ts), 0).Format(layout)
-		return strconv.AppendQuote(data, x), nil
+		return time.Unix(int64(ts), 0).Format(layout)
 }
 
 
@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"log"
+	"mime"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// MaxAttempts is how often a notification is tried before it is given up.
+	MaxAttempts = 8
+	// lease keeps a claimed notification from being claimed again while it is
+	// being sent.
+	lease     = 5 * time.Minute
+	batchSize = 20
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+var templates = map[string]*template.Template{}
+
+func init() {
+	for _, kind := range []string{models.NotifyBookingConfirmed, models.NotifyTableChanged, models.NotifyReminder,
+		models.NotifyWaitlistPromoted} {
+		templates[kind] = template.Must(template.ParseFS(templateFiles, "templates/"+kind+".tmpl"))
+	}
+}
+
+// Message is one email to a guest.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages to guests.
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Render fills in the template of a notification for event.
+func Render(n models.Notification, event models.Event) (Message, error) {
+	t, ok := templates[n.Kind]
+	if !ok {
+		return Message{}, fmt.Errorf("no template for %q notifications", n.Kind)
+	}
+	if event.Name == "" {
+		event.Name = "the event"
+	}
+	data := struct {
+		Reservation models.NotificationData
+		Event       models.Event
+	}{n.Data, event}
+	var subject, body bytes.Buffer
+	if err := t.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := t.ExecuteTemplate(&body, "body", data); err != nil {
+		return Message{}, err
+	}
+	return Message{To: n.Recipient, Subject: strings.TrimSpace(subject.String()), Body: body.String()}, nil
+}
+
+// SMTP sends messages through an SMTP server.
+type SMTP struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTP returns a notifier sending from the address from through the
+// server at addr (host:port). Without a username no authentication is used.
+func NewSMTP(addr, from, username, password string) *SMTP {
+	s := &SMTP{addr: addr, from: from}
+	if username != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			host = addr[:i]
+		}
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, b.Bytes())
+}
+
+// Backoff is how long to wait before the next attempt after the given failed
+// one: 1m, 2m, 4m and so on, at most 6 hours.
+func Backoff(attempt int) time.Duration {
+	d := time.Minute
+	for i := 1; i < attempt && d < 6*time.Hour; i++ {
+		d *= 2
+	}
+	if d > 6*time.Hour {
+		d = 6 * time.Hour
+	}
+	return d
+}
+
+// Store is the outbox the Sender sends from.
+type Store interface {
+	QueueReminders(ctx context.Context) (int, error)
+	ClaimNotifications(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.Notification, error)
+	RecordNotificationAttempt(ctx context.Context, id int64, attempt int, sendErr error, attemptedAt, retryAt time.Time) error
+}
+
+// Sender sends the notifications waiting in the outbox, and queues the
+// reminders when the event is close.
+type Sender struct {
+	store        Store
+	notifier     Notifier
+	event        models.Event
+	reminderLead time.Duration
+}
+
+// NewSender returns a Sender for event. Reminders are queued reminderLead
+// before the event starts; never when the start is not known or the lead is 0.
+func NewSender(store Store, notifier Notifier, event models.Event, reminderLead time.Duration) *Sender {
+	return &Sender{store: store, notifier: notifier, event: event, reminderLead: reminderLead}
+}
+
+// Run sends the due notifications every interval until ctx is done.
+func (s *Sender) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.SendDue(ctx); err != nil {
+			log.Printf("sending notifications failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDue queues the reminders if it is time, makes one attempt at every
+// notification that is due and returns how many were sent.
+func (s *Sender) SendDue(ctx context.Context) (int, error) {
+	if s.remindersDue(time.Now()) {
+		queued, err := s.store.QueueReminders(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if queued > 0 {
+			log.Printf("%d reminders were queued", queued)
+		}
+	}
+	sent := 0
+	for {
+		notifications, err := s.store.ClaimNotifications(ctx, time.Now(), lease, batchSize)
+		if err != nil {
+			return sent, err
+		}
+		for _, n := range notifications {
+			ok, err := s.send(ctx, n)
+			if err != nil {
+				return sent, err
+			}
+			if ok {
+				sent++
+			}
+		}
+		if len(notifications) < batchSize {
+			return sent, nil
+		}
+	}
+}
+
+// remindersDue reports whether now is within the reminder lead before the
+// start of the event; no reminders are sent once it started.
+func (s *Sender) remindersDue(now time.Time) bool {
+	if s.event.Start.IsZero() || s.reminderLead <= 0 {
+		return false
+	}
+	return !now.Before(s.event.Start.Add(-s.reminderLead)) && now.Before(s.event.Start)
+}
+
+func (s *Sender) send(ctx context.Context, n models.Notification) (bool, error) {
+	attempt := n.Attempts + 1
+	start := time.Now()
+	msg, err := Render(n, s.event)
+	if err == nil {
+		err = s.notifier.Send(ctx, msg)
+	}
+	var retryAt time.Time
+	if err != nil {
+		if attempt < MaxAttempts {
+			retryAt = start.Add(Backoff(attempt))
+		} else {
+			log.Printf("notification id=%v was given up after %d attempts: %v", n.Id, attempt, err)
+		}
+	}
+	return err == nil, s.store.RecordNotificationAttempt(ctx, n.Id, attempt, err, start, retryAt)
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxAuditEntries = 1000
+
+// reservationState loads a reservation as the audit log records it, with the
+// seats it holds on each table and its named guests.
+func (m *mysqlGuestRepo) reservationState(ctx context.Context, tx *sql.Tx, reservationId int64) (*models.ReservationState, error) {
+	var r models.ReservationState
+	var nTable sql.NullInt32
+	var nGroup, nGuests, nArrival sql.NullInt64
+	var nCode sql.NullString
+	err := tx.QueryRowContext(ctx,
+		"SELECT id, name, table_id, table_group_id, accompanying_guests, status, arrival_time, confirmation_code, "+
+			"dietary_needs, diet, gluten_free, nut_allergy FROM guestsList WHERE id = ?",
+		reservationId).Scan(&r.Id, &r.Name, &nTable, &nGroup, &nGuests, &r.Status, &nArrival, &nCode,
+		&r.DietaryNeeds, &r.Diet, &r.GlutenFree, &r.NutAllergy)
+	if err != nil {
+		return nil, err
+	}
+	r.TableId = nTable.Int32
+	r.TableGroupId = nGroup.Int64
+	r.AccompanyingGuests = nGuests.Int64
+	r.ArrivalTime = nArrival.Int64
+	r.ConfirmationCode = nCode.String
+	if r.Tables, err = m.getSeatAllocations(ctx, tx, reservationId); err != nil {
+		return nil, err
+	}
+	if r.Tables == nil {
+		r.Tables = []models.SeatAllocation{}
+	}
+	if r.Members, err = m.getPartyMembers(ctx, tx, reservationId); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// auditReservation records a change of a reservation. before is its state as
+// loaded by reservationState ahead of the change, nil for a new reservation;
+// the state after is loaded now.
+func (m *mysqlGuestRepo) auditReservation(ctx context.Context, tx *sql.Tx, action string, reservationId int64,
+	before *models.ReservationState) error {
+	after, err := m.reservationState(ctx, tx, reservationId)
+	if err != nil {
+		return err
+	}
+	if isWebhookEvent(action) {
+		if err = m.enqueueWebhooks(ctx, tx, action, after); err != nil {
+			return err
+		}
+	}
+	if kind := notificationKind(action, before, after); kind != "" {
+		if err = m.enqueueNotification(ctx, tx, kind, after); err != nil {
+			return err
+		}
+	}
+	entry := models.AuditEntry{Action: action, ReservationId: reservationId, TableIds: stateTables(before, after)}
+	if before == nil {
+		return m.record(ctx, tx, entry, nil, after)
+	}
+	return m.record(ctx, tx, entry, before, after)
+}
+
+// stateTables lists the tables a reservation sat at or was booked for in any
+// of the states.
+func stateTables(states ...*models.ReservationState) []int64 {
+	seen := map[int64]bool{}
+	var tableIds []int64
+	add := func(id int64) {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			tableIds = append(tableIds, id)
+		}
+	}
+	for _, s := range states {
+		if s == nil {
+			continue
+		}
+		add(int64(s.TableId))
+		for _, a := range s.Tables {
+			add(int64(a.TableId))
+		}
+	}
+	sort.Slice(tableIds, func(i, j int) bool { return tableIds[i] < tableIds[j] })
+	return tableIds
+}
+
+// record appends one entry to the audit log, as done by the actor of ctx.
+// before and after are stored as JSON; nil leaves them out.
+func (m *mysqlGuestRepo) record(ctx context.Context, tx *sql.Tx, entry models.AuditEntry, before, after interface{}) error {
+	var values [2]sql.NullString
+	for i, v := range []interface{}{before, after} {
+		if v == nil {
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		values[i] = sql.NullString{String: string(b), Valid: true}
+	}
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO audit_log(occurred_at, actor, action, reservation_id, before_state, after_state) "+
+			"VALUES (?, ?, ?, ?, ?, ?)",
+		time.Now().UTC().Unix(), repository.Actor(ctx), entry.Action,
+		sql.NullInt64{Int64: entry.ReservationId, Valid: entry.ReservationId != 0}, values[0], values[1])
+	if err != nil {
+		return err
+	}
+	auditId, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	// The tables an entry concerns get a row each, however many there are.
+	seen := map[int64]bool{}
+	for _, tableId := range entry.TableIds {
+		if seen[tableId] {
+			continue
+		}
+		seen[tableId] = true
+		_, err = tx.ExecContext(ctx, "INSERT INTO audit_log_tables(audit_id, table_id) VALUES (?, ?)", auditId, tableId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LatestAuditId returns the id of the newest audit log entry, 0 for an empty
+// log.
+func (m *mysqlGuestRepo) LatestAuditId(ctx context.Context) (int64, error) {
+	var id sql.NullInt64
+	err := m.Conn.QueryRowContext(ctx, "SELECT MAX(id) FROM audit_log").Scan(&id)
+	return id.Int64, err
+}
+
+// GetAuditLog returns the entries matching filter, oldest first.
+func (m *mysqlGuestRepo) GetAuditLog(ctx context.Context, filter models.AuditFilter) (*models.AuditLog, error) {
+	query := "SELECT id, occurred_at, actor, action, reservation_id, before_state, after_state " +
+		"FROM audit_log WHERE id > ?"
+	args := []interface{}{filter.AfterId}
+	if filter.ReservationId != 0 {
+		query += " AND reservation_id = ?"
+		args = append(args, filter.ReservationId)
+	}
+	if filter.TableId != 0 {
+		query += " AND id IN (SELECT audit_id FROM audit_log_tables WHERE table_id = ?)"
+		args = append(args, filter.TableId)
+	}
+	if !filter.From.IsZero() {
+		query += " AND occurred_at >= ?"
+		args = append(args, filter.From.Unix())
+	}
+	if !filter.To.IsZero() {
+		query += " AND occurred_at <= ?"
+		args = append(args, filter.To.Unix())
+	}
+	limit := filter.Limit
+	if limit <= 0 || limit > maxAuditEntries {
+		limit = maxAuditEntries
+	}
+	query += " ORDER BY id LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := m.Conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var nReservation sql.NullInt64
+		var nBefore, nAfter sql.NullString
+		if err := rows.Scan(&e.Id, &e.OccurredAt, &e.Actor, &e.Action, &nReservation, &nBefore, &nAfter); err != nil {
+			return nil, err
+		}
+		e.ReservationId = nReservation.Int64
+		if nBefore.Valid {
+			e.Before = json.RawMessage(nBefore.String)
+		}
+		if nAfter.Valid {
+			e.After = json.RawMessage(nAfter.String)
+		}
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if err = m.auditTables(ctx, entries); err != nil {
+		return nil, err
+	}
+	return &models.AuditLog{Entries: entries}, nil
+}
+
+// auditTables fills in the tables of each of entries.
+func (m *mysqlGuestRepo) auditTables(ctx context.Context, entries []models.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	index := map[int64]int{}
+	ids := make([]interface{}, len(entries))
+	for i, e := range entries {
+		index[e.Id] = i
+		ids[i] = e.Id
+	}
+	rows, err := m.Conn.QueryContext(ctx,
+		"SELECT audit_id, table_id FROM audit_log_tables WHERE audit_id IN (?"+strings.Repeat(", ?", len(ids)-1)+") "+
+			"ORDER BY audit_id, table_id", ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var auditId, tableId int64
+		if err := rows.Scan(&auditId, &tableId); err != nil {
+			return err
+		}
+		e := &entries[index[auditId]]
+		e.TableIds = append(e.TableIds, tableId)
+	}
+	return rows.Err()
+}
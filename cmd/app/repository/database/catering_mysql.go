@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"sort"
+)
+
+// GetCateringReport counts the special meals needed at each table. Main
+// guests and their named party members are counted; only reservations that
+// are still expected or already seated take part. Each person is counted at
+// the table of their seat: the one assigned to them, else the next seat of the
+// party not assigned to anybody, else the booking table.
+func (m *mysqlGuestRepo) GetCateringReport(ctx context.Context) (*models.CateringReport, error) {
+	tx, err := m.Conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// people lists the main guest, guest 0, then the named members of each
+	// reservation in roster order.
+	people := map[int64][]models.DietaryRequirements{}
+	bookingTable := map[int64]int32{}
+	var reservationIds []int64
+	rows, err := tx.QueryContext(ctx,
+		"SELECT g.id, g.table_id, g.diet, g.gluten_free, g.nut_allergy FROM guestsList g "+
+			"WHERE g.status IN (?, ?) ORDER BY g.id",
+		models.Upcoming, models.Attended)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var nTable sql.NullInt32
+		var d models.DietaryRequirements
+		if err := rows.Scan(&id, &nTable, &d.Diet, &d.GlutenFree, &d.NutAllergy); err != nil {
+			return nil, err
+		}
+		reservationIds = append(reservationIds, id)
+		bookingTable[id] = nTable.Int32
+		people[id] = []models.DietaryRequirements{d}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	members, err := tx.QueryContext(ctx,
+		"SELECT p.reservation_id, p.diet, p.gluten_free, p.nut_allergy FROM party_members p "+
+			"JOIN guestsList g ON g.id = p.reservation_id WHERE g.status IN (?, ?) ORDER BY p.reservation_id, p.id",
+		models.Upcoming, models.Attended)
+	if err != nil {
+		return nil, err
+	}
+	defer members.Close()
+	for members.Next() {
+		var id int64
+		var d models.DietaryRequirements
+		if err := members.Scan(&id, &d.Diet, &d.GlutenFree, &d.NutAllergy); err != nil {
+			return nil, err
+		}
+		people[id] = append(people[id], d)
+	}
+	if err = members.Err(); err != nil {
+		return nil, err
+	}
+
+	// assigned is the table of each guest on an assigned seat, free the tables
+	// of the other seats of the party in the order they are filled.
+	assigned := map[int64]map[int64]int32{}
+	free := map[int64][]int32{}
+	seats, err := tx.QueryContext(ctx,
+		"SELECT s.reservation_id, s.table_id, s.guest_index FROM seats s "+
+			"JOIN reservation_tables rt ON rt.reservation_id = s.reservation_id AND rt.table_id = s.table_id "+
+			"JOIN guestsList g ON g.id = s.reservation_id WHERE g.status IN (?, ?) "+
+			"ORDER BY s.reservation_id, rt.position, s.position",
+		models.Upcoming, models.Attended)
+	if err != nil {
+		return nil, err
+	}
+	defer seats.Close()
+	for seats.Next() {
+		var id int64
+		var tableId int32
+		var guest sql.NullInt64
+		if err := seats.Scan(&id, &tableId, &guest); err != nil {
+			return nil, err
+		}
+		if !guest.Valid {
+			free[id] = append(free[id], tableId)
+			continue
+		}
+		if assigned[id] == nil {
+			assigned[id] = map[int64]int32{}
+		}
+		assigned[id][guest.Int64] = tableId
+	}
+	if err = seats.Err(); err != nil {
+		return nil, err
+	}
+
+	counts := map[int32]*models.CateringCounts{}
+	for _, id := range reservationIds {
+		next := free[id]
+		for guest, d := range people[id] {
+			tableId, ok := assigned[id][int64(guest)]
+			if !ok && len(next) > 0 {
+				tableId, next = next[0], next[1:]
+			} else if !ok {
+				tableId = bookingTable[id]
+			}
+			if counts[tableId] == nil {
+				counts[tableId] = &models.CateringCounts{}
+			}
+			counts[tableId].Count(d)
+		}
+	}
+
+	report := &models.CateringReport{Tables: []models.TableCatering{}}
+	for tableId, c := range counts {
+		report.Tables = append(report.Tables, models.TableCatering{TableId: tableId, CateringCounts: *c})
+		report.Total.Add(*c)
+	}
+	sort.Slice(report.Tables, func(i, j int) bool { return report.Tables[i].TableId < report.Tables[j].TableId })
+	return report, nil
+}
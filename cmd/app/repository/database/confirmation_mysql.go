@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository"
+	"log"
+	"math/big"
+	"strings"
+)
+
+// confirmationAlphabet leaves out 0, O, 1 and I, which are easily confused
+// when a code is read out over the phone.
+const confirmationAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const confirmationCodeLength = 6
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func newConfirmationCode() (string, error) {
+	code := make([]byte, confirmationCodeLength)
+	max := big.NewInt(int64(len(confirmationAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = confirmationAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// uniqueConfirmationCode draws codes until one is not in use yet. The unique
+// index on the column still guards against a concurrent insert.
+func uniqueConfirmationCode(ctx context.Context, q queryRower) (string, error) {
+	for attempt := 0; attempt < 10; attempt++ {
+		code, err := newConfirmationCode()
+		if err != nil {
+			return "", err
+		}
+		var id int64
+		err = q.QueryRowContext(ctx, "SELECT id FROM guestsList WHERE confirmation_code = ?", code).Scan(&id)
+		if err == sql.ErrNoRows {
+			return code, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", errors.New("could not find a free confirmation code")
+}
+
+// normaliseConfirmationCode turns a code as typed by a guest into the stored
+// form.
+func normaliseConfirmationCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer(" ", "", "-", "").Replace(code)
+	return code
+}
+
+func (m *mysqlGuestRepo) GetReservationByCode(ctx context.Context, code string) (*models.GuestsReservation, error) {
+	tx, err := m.Conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getReservationByCode(ctx, tx, m.readReservationBy, code)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.Tables, err = m.getSplitAllocations(ctx, tx, reservation.Id); err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+func (m *mysqlGuestRepo) CheckInByCode(ctx context.Context, code string, guest *models.GuestsReservation) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getReservationByCode(ctx, tx, m.getReservationBy, code)
+	if err != nil {
+		return err
+	}
+	if err = m.registerArrival(ctx, tx, reservation, guest.AccompanyingGuests); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+
+	guest.Name = reservation.Name
+	guest.ConfirmationCode = reservation.ConfirmationCode
+	log.Printf("the guests: %s (reservationId=%v) arrived", reservation.Name, reservation.Id)
+	return nil
+}
+
+func (m *mysqlGuestRepo) CancelByCode(ctx context.Context, code string) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getReservationByCode(ctx, tx, m.getReservationBy, code)
+	if err != nil {
+		return err
+	}
+	if err = m.cancel(ctx, tx, reservation); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+	log.Printf("reservation id=%v was cancelled", reservation.Id)
+	return nil
+}
+
+func (m *mysqlGuestRepo) getReservationByCode(ctx context.Context, tx *sql.Tx, lookup reservationLookup,
+	code string) (*models.GuestsReservation, error) {
+	code = normaliseConfirmationCode(code)
+	reservation, err := lookup(ctx, tx, "confirmation_code", code)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrUnknownCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	reservation.ConfirmationCode = code
+	return reservation, nil
+}
+
+// CheckInById registers the arrival of a party from its signed check-in
+// token. A token can be used once, and not at all once the party arrived
+// some other way; without a party size the booked one is assumed.
+func (m *mysqlGuestRepo) CheckInById(ctx context.Context, reservationId int64, guest *models.GuestsReservation) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getReservationBy(ctx, tx, "id", reservationId)
+	if err != nil {
+		return err
+	}
+	var usedAt sql.NullInt64
+	err = tx.QueryRowContext(ctx, "SELECT checkin_used_at FROM guestsList WHERE id = ?", reservationId).Scan(&usedAt)
+	if err != nil {
+		return err
+	}
+	if usedAt.Valid || reservation.Status == models.Attended {
+		return repository.ErrAlreadyCheckedIn
+	}
+
+	accompanyingGuests := guest.AccompanyingGuests
+	if accompanyingGuests == 0 {
+		accompanyingGuests = reservation.AccompanyingGuests
+	}
+	if err = m.registerArrival(ctx, tx, reservation, accompanyingGuests); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+
+	guest.Name = reservation.Name
+	guest.ConfirmationCode = reservation.ConfirmationCode
+	guest.AccompanyingGuests = accompanyingGuests
+	log.Printf("the guests: %s (reservationId=%v) checked in with their token", reservation.Name, reservation.Id)
+	return nil
+}
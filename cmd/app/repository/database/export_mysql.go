@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+)
+
+// StreamGuests calls fn for each reservation of the guest list, or only for
+// the parties that have arrived, in alphabetical order. Rows are handed over
+// as they are read, so exports of large events are never held in memory.
+func (m *mysqlGuestRepo) StreamGuests(ctx context.Context, arrivedOnly bool, fn func(models.GuestsReservation) error) error {
+	allocations, err := m.getAllSeatAllocations()
+	if err != nil {
+		return err
+	}
+
+	query := "SELECT g.id, g.name, g.table_id, g.table_group_id, g.accompanying_guests, g.status, COALESCE(g.arrival_time, 0), " +
+		"g.confirmation_code, g.dietary_needs, g.diet, g.gluten_free, g.nut_allergy FROM guestsList g "
+	var args []interface{}
+	if arrivedOnly {
+		query += "WHERE g.status = ? "
+		args = append(args, models.Attended)
+	} else {
+		query += "WHERE g.status NOT IN (?, ?, ?) "
+		args = append(args, models.Invited, models.Declined, models.Cancelled)
+	}
+	rows, err := m.Conn.QueryContext(ctx, query+"ORDER BY g.name", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.GuestsReservation
+		var nTable sql.NullInt32
+		var nGroup, nGuests sql.NullInt64
+		var nCode sql.NullString
+		if err := rows.Scan(&r.Id, &r.Name, &nTable, &nGroup, &nGuests, &r.Status, &r.ArrivalTime, &nCode,
+			&r.DietaryNeeds, &r.Diet, &r.GlutenFree, &r.NutAllergy); err != nil {
+			return err
+		}
+		r.TableId = nTable.Int32
+		r.TableGroupId = nGroup.Int64
+		r.AccompanyingGuests = nGuests.Int64
+		r.ConfirmationCode = nCode.String
+		r.Tables = allocations[r.Id]
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
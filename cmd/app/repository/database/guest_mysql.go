@@ -3,7 +3,6 @@ package database
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"github.com/getground/tech-tasks/backend/cmd/app/models"
 	"github.com/getground/tech-tasks/backend/cmd/app/repository"
@@ -13,6 +12,7 @@ import (
 
 type mysqlGuestRepo struct {
 	Conn *sql.DB
+	committed func()
 }
 
 func NewSQLGuestRepo(Conn *sql.DB) repository.GuestRepo {
@@ -21,24 +21,59 @@ func NewSQLGuestRepo(Conn *sql.DB) repository.GuestRepo {
 	}
 }
 
+// OnCommit sets fn to be called after every transaction that changes tables
+// or reservations is committed. It must be set before the repository is used.
+func (m *mysqlGuestRepo) OnCommit(fn func()) {
+	m.committed = fn
+}
+
+func (m *mysqlGuestRepo) commit(tx *sql.Tx) error {
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if m.committed != nil {
+		m.committed()
+	}
+	return nil
+}
+
 func (m *mysqlGuestRepo) CreateTableId(ctx context.Context, table models.Table) (int64, error){
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
 
-	stmt, err := m.Conn.PrepareContext(
+	res, err := tx.ExecContext(
 		ctx,
-		"INSERT INTO tables(capacity, booked_seats, available_seats) VALUES(?, ?, ?);")
+		"INSERT INTO tables(capacity, booked_seats, available_seats) VALUES(?, ?, ?);",
+		table.Capacity, 0, table.Capacity)
 	if err != nil {
 		return -1, err
 	}
-	res, err := stmt.ExecContext(ctx, table.Capacity, 0, table.Capacity)
+	tableId, err := res.LastInsertId()
 	if err != nil {
 		return -1, err
 	}
-	defer stmt.Close()
 
-	tableId, err := res.LastInsertId()
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO seats(table_id, position) VALUES(?, ?);")
 	if err != nil {
 		return -1, err
 	}
+	defer stmt.Close()
+	for position := 1; position <= table.Capacity; position++ {
+		if _, err = stmt.ExecContext(ctx, tableId, position); err != nil {
+			return -1, err
+		}
+	}
+	entry := models.AuditEntry{Action: models.AuditTableCreated, TableIds: []int64{tableId}}
+	after := models.Table{Id: tableId, Capacity: table.Capacity, AvailableSeats: table.Capacity}
+	if err = m.record(ctx, tx, entry, nil, after); err != nil {
+		return -1, err
+	}
+	if err = m.commit(tx); err != nil {
+		return -1, err
+	}
 	return tableId, nil
 }
 
@@ -50,38 +85,60 @@ func (m *mysqlGuestRepo) CreateGuestReservationID (ctx context.Context, guest *m
 	}
 	defer tx.Rollback()
 
-	ok, err:=m.checkIfTableAvailable(ctx, tx, guest.AccompanyingGuests, guest.TableId)
-	if err !=nil {
+	if err = m.createReservation(ctx, tx, guest); err != nil {
 		return err
 	}
-	if !ok {
-		log.Printf("not enough seats, tableId=%v", guest.TableId)
-		return errors.New("not enough seats")
+	if err = m.commit(tx); err != nil {
+		return err
 	}
 
-	_, err = tx.ExecContext(
-		ctx,
-		"UPDATE tables SET booked_seats= booked_seats + ?, available_seats = available_seats-? where id = ?",
-		guest.AccompanyingGuests, guest.AccompanyingGuests, guest.TableId)
+	log.Printf("New reservation id=%v was added", guest.Id)
+	return nil
+}
+
+// createReservation books the seats of a new reservation and fills in its id,
+// token and confirmation code.
+func (m *mysqlGuestRepo) createReservation(ctx context.Context, tx *sql.Tx, guest *models.GuestsReservation) error {
+	tableIds, err := m.candidateTables(ctx, tx, guest.TableId, guest.TableGroupId)
 	if err != nil {
 		return err
 	}
+	if guest.TableGroupId != 0 {
+		guest.TableId = tableIds[0]
+	}
+	token, err := newReservationToken()
+	if err != nil {
+		return err
+	}
+	code, err := uniqueConfirmationCode(ctx, tx)
+	if err != nil {
+		return err
+	}
+
 	res, err := tx.ExecContext(
 		ctx,
-		"INSERT INTO guestsList(table_id, name, accompanying_guests, status) VALUES (?, ?, ?, ?);",
-		guest.TableId, guest.Name, guest.AccompanyingGuests, models.Status(models.Upcoming))
+		"INSERT INTO guestsList(table_id, table_group_id, name, accompanying_guests, status, rsvp_token, confirmation_code, "+
+			"dietary_needs, diet, gluten_free, nut_allergy, email) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);",
+		guest.TableId, nullGroupId(guest.TableGroupId), guest.Name, guest.AccompanyingGuests, models.Status(models.Upcoming),
+		token, code, guest.DietaryNeeds, guest.Diet, guest.GlutenFree, guest.NutAllergy, guest.Email)
 	if err != nil {
 		return err
 	}
-	tableId, err := res.LastInsertId()
+	reservationId, err := res.LastInsertId()
 	if err != nil {
 		return err
 	}
-	if err = tx.Commit(); err != nil {
+	if err = m.allocateSeats(ctx, tx, reservationId, tableIds, guest.AccompanyingGuests); err != nil {
+		log.Printf("cannot seat reservation for %s, tables=%v: %v", guest.Name, tableIds, err)
+		return err
+	}
+	if err = m.auditReservation(ctx, tx, models.AuditReservationCreated, reservationId, nil); err != nil {
 		return err
 	}
 
-	log.Printf("New reservation id=%v was added", tableId)
+	guest.Id = reservationId
+	guest.RsvpToken = token
+	guest.ConfirmationCode = code
 	return nil
 }
 
@@ -92,124 +149,131 @@ func (m *mysqlGuestRepo) CheckAvailableSeats (ctx context.Context, guest *models
 	}
 	defer tx.Rollback()
 
-	reservationId, tableId, err := m.getReservationId(tx, guest.Name)
+	reservation, err := m.getReservation(ctx, tx, guest.Name)
 	if err!=nil {
 		return err
 	}
+	if err = m.registerArrival(ctx, tx, reservation, guest.AccompanyingGuests); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+	log.Printf("the guests: %s (reservationId=%v) arrived", guest.Name , reservation.Id)
+	return nil
+}
 
-	var diffGuestsNumber int64
-	diffGuestsNumber, err= m.getAvailableSeatsAmount(tx, ctx, guest, reservationId)
-	if err!=nil {
+// registerArrival marks a party as arrived with the number of accompanying
+// guests that actually came, booking or giving back the difference. Its
+// check-in token counts as used from then on.
+func (m *mysqlGuestRepo) registerArrival(ctx context.Context, tx *sql.Tx, reservation *models.GuestsReservation,
+	accompanyingGuests int64) error {
+	if reservation.Status == models.Invited || reservation.Status == models.Declined {
+		return fmt.Errorf("%s has not accepted the invitation", reservation.Name)
+	}
+	if reservation.Status == models.Cancelled {
+		return fmt.Errorf("the reservation for %s was cancelled", reservation.Name)
+	}
+	if reservation.Status == models.Archived {
+		return repository.ErrReservationClosed
+	}
+	if err := m.checkRoster(ctx, tx, reservation, accompanyingGuests); err != nil {
+		return err
+	}
+	before, err := m.reservationState(ctx, tx, reservation.Id)
+	if err != nil {
 		return err
 	}
 
+	diffGuestsNumber := accompanyingGuests - reservation.AccompanyingGuests
 	switch {
-		case diffGuestsNumber==0:
-			_, err = tx.ExecContext(
-				ctx,
-				"UPDATE guestsList SET status = ? where id=?", models.Attended, reservationId)
-			if err != nil {
-				return err
-			}
 		case diffGuestsNumber>0:
-			ok, err:=m.checkIfTableAvailable(ctx, tx, diffGuestsNumber, tableId)
-				if err !=nil {
-					return err
-				}
-			if !ok {
-				log.Println("not enough seats, tableId=%v", tableId)
+			tableIds, err := m.candidateTables(ctx, tx, reservation.TableId, reservation.TableGroupId)
+			if err != nil {
 				return err
 			}
-			err = m.updateSeatsAmount(ctx, tx, diffGuestsNumber, guest, reservationId, tableId)
-			if err != nil {
+			if err = m.allocateSeats(ctx, tx, reservation.Id, tableIds, diffGuestsNumber); err != nil {
+				log.Printf("cannot seat extra guests, reservationId=%v: %v", reservation.Id, err)
 				return err
 			}
 		case diffGuestsNumber<0:
-			err := m.updateSeatsAmount(ctx, tx, diffGuestsNumber, guest, reservationId, tableId)
-			if err != nil {
+			if err = m.releaseSeats(ctx, tx, reservation.Id, -diffGuestsNumber); err != nil {
 				return err
 			}
 		}
-	if err = tx.Commit(); err != nil {
+	if err = m.updateArrival(ctx, tx, accompanyingGuests, reservation.Id); err != nil {
 		return err
 	}
-	log.Printf("the guests: %s (reservationId=%v) arrived", guest.Name , reservationId)
-	return nil
+	return m.auditReservation(ctx, tx, models.AuditArrived, reservation.Id, before)
 }
-func (m *mysqlGuestRepo) getReservationId(tx *sql.Tx, name string) (int32, int32, error) {
-	var reservationId int32
-	var tableId int32
-	var nTable sql.NullInt32
-	var nReservation sql.NullInt32
-	err := tx.QueryRow(
-		"SELECT g.id, g.table_id FROM guestsList g where g.name=? ", name).Scan(&nReservation, &nTable)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return -1, -1, err
-		}
-		return -1, -1, err
-	}
-	if nTable.Valid && nReservation.Valid {
-		tableId = nTable.Int32
-		reservationId = nReservation.Int32
-	}
-	return reservationId, tableId, nil
+
+func (m *mysqlGuestRepo) getReservation(ctx context.Context, tx *sql.Tx, name string) (*models.GuestsReservation, error) {
+	return m.getReservationBy(ctx, tx, "name", name)
 }
 
-func (m *mysqlGuestRepo) getAvailableSeatsAmount(tx *sql.Tx, ctx context.Context,  guests *models.GuestsReservation,
-	reservationId int32) (int64, error)  {
-	var updateGuestNumber int64
-	var n sql.NullInt64
-	err := tx.QueryRowContext(ctx, "SELECT ?- accompanying_guests from guestsList where id = ?",
-		guests.AccompanyingGuests, reservationId).Scan(&n)
-	if err != nil {
-		log.Printf("no such reservation id=%v", guests.Id)
-		return -1, err
-	}
-	if n.Valid {
-		updateGuestNumber = n.Int64
-	}
-	return updateGuestNumber, err
+// readReservation loads a reservation without locking it, for the read paths.
+func (m *mysqlGuestRepo) readReservation(ctx context.Context, tx *sql.Tx, name string) (*models.GuestsReservation, error) {
+	return m.readReservationBy(ctx, tx, "name", name)
 }
 
-func (m *mysqlGuestRepo) checkIfTableAvailable(ctx context.Context, tx *sql.Tx, val int64, tableId int32) (bool, error) {
-	var enough bool
-	if err := tx.QueryRowContext(ctx, "SELECT (available_seats >= ?) from tables where id = ?",
-		val, tableId).Scan(&enough); err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("no such table with id=%v", tableId)
-			return false, fmt.Errorf("no such table_id=%v", tableId)
-		}
-		return false, fmt.Errorf("checkIfTableAvailable %d: %v", tableId)
-	}
-	return enough, nil
+// reservationLookup loads the reservation whose column matches value.
+type reservationLookup func(ctx context.Context, tx *sql.Tx, column string, value interface{}) (*models.GuestsReservation, error)
+
+// getReservationBy loads the reservation whose column matches value and locks
+// it for the rest of the transaction. column is never user input.
+func (m *mysqlGuestRepo) getReservationBy(ctx context.Context, tx *sql.Tx, column string, value interface{}) (*models.GuestsReservation, error) {
+	return m.queryReservationBy(ctx, tx, column, value, " FOR UPDATE")
 }
 
+// readReservationBy is getReservationBy without the lock, so that it can be
+// used in read-only transactions.
+func (m *mysqlGuestRepo) readReservationBy(ctx context.Context, tx *sql.Tx, column string, value interface{}) (*models.GuestsReservation, error) {
+	return m.queryReservationBy(ctx, tx, column, value, "")
+}
 
-func (m *mysqlGuestRepo) updateSeatsAmount(ctx context.Context, tx *sql.Tx,
-											diffGuestNumber int64, guestReservation *models.GuestsReservation,
-											reservationId int32, tableId int32) error {
-	tArrival := time.Now().UTC().Unix()
-	_, err := tx.ExecContext(
-		ctx,
-		"UPDATE tables SET booked_seats= booked_seats + ?, available_seats = available_seats - ? where id = ?",
-		diffGuestNumber, diffGuestNumber, tableId)
+func (m *mysqlGuestRepo) queryReservationBy(ctx context.Context, tx *sql.Tx, column string, value interface{}, lock string) (*models.GuestsReservation, error) {
+	var r models.GuestsReservation
+	var nTable sql.NullInt32
+	var nGroup sql.NullInt64
+	var nGuests sql.NullInt64
+	// A name can come back after its reservation was cancelled, declined or
+	// archived; the live reservation wins, then the newest.
+	err := tx.QueryRowContext(ctx,
+		"SELECT g.id, g.name, g.table_id, g.table_group_id, g.accompanying_guests, g.status, g.confirmation_code, "+
+			"g.dietary_needs, g.diet, g.gluten_free, g.nut_allergy FROM guestsList g where g."+column+"=? "+
+			"ORDER BY g.status IN (?, ?, ?), g.id DESC LIMIT 1"+lock,
+		value, models.Archived, models.Declined, models.Cancelled).Scan(&r.Id, &r.Name, &nTable, &nGroup, &nGuests, &r.Status, &r.ConfirmationCode,
+		&r.DietaryNeeds, &r.Diet, &r.GlutenFree, &r.NutAllergy)
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			log.Printf("no such reservation for %s=%v", column, value)
+		}
+		return nil, err
 	}
+	r.TableId = nTable.Int32
+	r.TableGroupId = nGroup.Int64
+	r.AccompanyingGuests = nGuests.Int64
+	return &r, nil
+}
 
-	_, err = tx.ExecContext(ctx,
-		"UPDATE guestsList SET accompanying_guests = ?, status = ?, arrival_time=? where id=?",
-		guestReservation.AccompanyingGuests, models.Attended, tArrival, reservationId)
-	if err != nil {
-		return err
-	}
-	return nil
+func (m *mysqlGuestRepo) updateArrival(ctx context.Context, tx *sql.Tx, accompanyingGuests int64, reservationId int64) error {
+	tArrival := time.Now().UTC().Unix()
+	_, err := tx.ExecContext(ctx,
+		"UPDATE guestsList SET accompanying_guests = ?, status = ?, arrival_time=?, checkin_used_at=? where id=?",
+		accompanyingGuests, models.Attended, tArrival, tArrival, reservationId)
+	return err
 }
 
 func (m *mysqlGuestRepo) GetGuestsList() (*models.GuestList, error) {
 
-	rows, err := m.Conn.Query("SELECT g.table_id, g.name, g.accompanying_guests FROM guestsList g")
+	allocations, err := m.getAllSeatAllocations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.Conn.Query(
+		"SELECT g.id, g.table_id, g.table_group_id, g.name, g.accompanying_guests FROM guestsList g "+
+			"where g.status NOT IN (?, ?, ?)", models.Invited, models.Declined, models.Cancelled)
 	if err != nil {
 		return nil, err
 	}
@@ -218,10 +282,13 @@ func (m *mysqlGuestRepo) GetGuestsList() (*models.GuestList, error) {
 	var guestReservations []models.GuestsReservation
 	for rows.Next() {
 		var r models.GuestsReservation
-		if err := rows.Scan(&r.TableId, &r.Name, &r.AccompanyingGuests); err != nil {
+		var nGroup sql.NullInt64
+		if err := rows.Scan(&r.Id, &r.TableId, &nGroup, &r.Name, &r.AccompanyingGuests); err != nil {
 			log.Printf("DB: Error during sql statement to get arrived guest , error=%v", err)
 			return nil, err
 		}
+		r.TableGroupId = nGroup.Int64
+		r.Tables = allocations[r.Id]
 	guestReservations = append(guestReservations, r)
 	}
 	if err = rows.Err(); err != nil {
@@ -257,7 +324,7 @@ func (m *mysqlGuestRepo) GetArrivedGuests() (*models.GuestList, error) {
 func (m *mysqlGuestRepo) GetEmptySeats() (*models.Seats, error) {
 	var emptySeats int32
 	var n sql.NullInt32
-	err := m.Conn.QueryRow("SELECT SUM(available_seats) FROM tables").Scan(&n)
+	err := m.Conn.QueryRow("SELECT COUNT(*) FROM seats WHERE reservation_id IS NULL").Scan(&n)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, err
@@ -270,6 +337,7 @@ func (m *mysqlGuestRepo) GetEmptySeats() (*models.Seats, error) {
 	return &models.Seats{SeatsEmpty: emptySeats}, nil
 }
 
+// GuestLeaves archives a party that is booked or in and gives back its seats.
 func (m *mysqlGuestRepo) GuestLeaves(ctx context.Context, name string) error {
 	tx, err := m.Conn.BeginTx(ctx, nil)
 	if err != nil {
@@ -277,41 +345,57 @@ func (m *mysqlGuestRepo) GuestLeaves(ctx context.Context, name string) error {
 	}
 	defer tx.Rollback()
 
-	var id int32
-	var tableId int32
-	var guestAmount int32
-	var nId sql.NullInt32
-	var nTableId sql.NullInt32
-	var nGuestAmount sql.NullInt32
-	err = tx.QueryRowContext(ctx,
-		"SELECT g.id, g.table_id, g.accompanying_guests from guestsList g where g.name = ?",
-		name).Scan(&nId, &nTableId, &nGuestAmount)
+	reservation, err := m.getReservation(ctx, tx, name)
 	if err != nil {
-		log.Printf("no such reservation for %s", name)
 		return err
 	}
-	if nId.Valid && nTableId.Valid && nGuestAmount.Valid  {
-		id = nId.Int32
-		tableId = nTableId.Int32
-		guestAmount = nGuestAmount.Int32
+	if reservation.Status != models.Upcoming && reservation.Status != models.Attended {
+		return repository.ErrReservationClosed
 	}
-	_, err = tx.ExecContext(
-		ctx,
-		"UPDATE tables SET booked_seats= booked_seats + ?, available_seats = available_seats - ? where id = ?",
-		guestAmount, guestAmount, tableId)
+	before, err := m.reservationState(ctx, tx, reservation.Id)
 	if err != nil {
 		return err
 	}
+	if err = m.releaseAllSeats(ctx, tx, reservation.Id); err != nil {
+		return err
+	}
 
-	_, err = tx.ExecContext(ctx,  "UPDATE guestsList SET accompanying_guests = ?, status = ? where id=?",
-		guestAmount, models.Archived, id)
+	_, err = tx.ExecContext(ctx,  "UPDATE guestsList SET status = ? where id=?",
+		models.Archived, reservation.Id)
 	if err != nil {
 		return err
 	}
-	if err = tx.Commit(); err != nil {
+	if err = m.auditReservation(ctx, tx, models.AuditLeft, reservation.Id, before); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
 		return err
 	}
 
-	log.Printf("the guests with id=%v left", id)
+	log.Printf("the guests with id=%v left", reservation.Id)
 	return nil
 }
+
+// GetReservationsForLookup returns the parties the front desk may be looking
+// for: those expected tonight and those already in.
+func (m *mysqlGuestRepo) GetReservationsForLookup(ctx context.Context) ([]models.GuestsReservation, error) {
+	rows, err := m.Conn.QueryContext(ctx,
+		"SELECT g.id, g.name, g.table_id, g.accompanying_guests, g.status, g.confirmation_code FROM guestsList g "+
+			"where g.status IN (?, ?)", models.Upcoming, models.Attended)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var guestReservations []models.GuestsReservation
+	for rows.Next() {
+		var r models.GuestsReservation
+		var nCode sql.NullString
+		if err := rows.Scan(&r.Id, &r.Name, &r.TableId, &r.AccompanyingGuests, &r.Status, &nCode); err != nil {
+			return nil, err
+		}
+		r.ConfirmationCode = nCode.String
+		guestReservations = append(guestReservations, r)
+	}
+	return guestReservations, rows.Err()
+}
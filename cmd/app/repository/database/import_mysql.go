@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"log"
+)
+
+// ImportReservations books a whole guest list in one transaction. Every row
+// is tried so that all problems are reported, but unless all of them succeed
+// nothing is kept.
+func (m *mysqlGuestRepo) ImportReservations(ctx context.Context, rows []models.ImportRow) ([]models.RowError, error) {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var rowErrors []models.RowError
+	for i := range rows {
+		guest := &rows[i].GuestsReservation
+		var id int64
+		err := tx.QueryRowContext(ctx,
+			"SELECT id FROM guestsList WHERE name = ? AND status NOT IN (?, ?, ?) LIMIT 1",
+			guest.Name, models.Archived, models.Declined, models.Cancelled).Scan(&id)
+		if err == nil {
+			rowErrors = append(rowErrors, models.RowError{Row: rows[i].Row, Name: guest.Name,
+				Message: "a reservation for " + guest.Name + " already exists"})
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+		if err = m.createReservation(ctx, tx, guest); err != nil {
+			rowErrors = append(rowErrors, models.RowError{Row: rows[i].Row, Name: guest.Name, Message: err.Error()})
+		}
+	}
+	if len(rowErrors) > 0 {
+		return rowErrors, nil
+	}
+	if err = m.commit(tx); err != nil {
+		return nil, err
+	}
+	log.Printf("%v reservations were imported", len(rows))
+	return nil, nil
+}
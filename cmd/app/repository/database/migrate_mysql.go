@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"log"
+)
+
+// schema creates the tables docker/mysql/dump.sql creates on a fresh volume,
+// for databases made before they existed. Keep the two in step.
+var schema = []string{
+	"CREATE TABLE IF NOT EXISTS `tables` (`id` INT NOT NULL auto_increment, PRIMARY KEY (`id`), capacity int, " +
+		"booked_seats int, available_seats int)",
+	"CREATE TABLE IF NOT EXISTS `table_groups` (`id` INT NOT NULL auto_increment, PRIMARY KEY (`id`), " +
+		"name VARCHAR(100) NOT NULL)",
+	"CREATE TABLE IF NOT EXISTS `table_group_members` (group_id INT NOT NULL, table_id INT NOT NULL, " +
+		"position int NOT NULL, PRIMARY KEY (group_id, table_id), FOREIGN KEY (group_id) REFERENCES table_groups(id), " +
+		"FOREIGN KEY (table_id) REFERENCES tables(id))",
+	"CREATE TABLE IF NOT EXISTS `guestsList` (`id` INT NOT NULL auto_increment, PRIMARY KEY (`id`), table_id INT, " +
+		"name VARCHAR(100) NOT NULL, accompanying_guests INT, status int, arrival_time bigint, " +
+		"FOREIGN KEY (table_id) REFERENCES tables(id))",
+	"CREATE TABLE IF NOT EXISTS `reservation_tables` (reservation_id INT NOT NULL, table_id INT NOT NULL, " +
+		"seats int NOT NULL, position int NOT NULL, PRIMARY KEY (reservation_id, table_id), " +
+		"FOREIGN KEY (reservation_id) REFERENCES guestsList(id), FOREIGN KEY (table_id) REFERENCES tables(id))",
+	"CREATE TABLE IF NOT EXISTS `seats` (`id` INT NOT NULL auto_increment, PRIMARY KEY (`id`), " +
+		"table_id INT NOT NULL, position int NOT NULL, reservation_id INT NULL, guest_index int NULL, " +
+		"UNIQUE (table_id, position), FOREIGN KEY (table_id) REFERENCES tables(id), " +
+		"FOREIGN KEY (reservation_id) REFERENCES guestsList(id))",
+	"CREATE TABLE IF NOT EXISTS `party_members` (`id` INT NOT NULL auto_increment, PRIMARY KEY (`id`), " +
+		"reservation_id INT NOT NULL, name VARCHAR(100) NOT NULL, dietary_needs VARCHAR(255) NOT NULL DEFAULT '', " +
+		"age_group VARCHAR(10) NOT NULL DEFAULT 'adult', accessibility VARCHAR(255) NOT NULL DEFAULT '', " +
+		"diet VARCHAR(20) NOT NULL DEFAULT '', gluten_free BOOLEAN NOT NULL DEFAULT FALSE, " +
+		"nut_allergy BOOLEAN NOT NULL DEFAULT FALSE, FOREIGN KEY (reservation_id) REFERENCES guestsList(id))",
+	"CREATE TABLE IF NOT EXISTS `audit_log` (`id` INT NOT NULL auto_increment, PRIMARY KEY (`id`), " +
+		"occurred_at bigint NOT NULL, actor VARCHAR(100) NOT NULL, action VARCHAR(50) NOT NULL, " +
+		"reservation_id INT NULL, before_state TEXT NULL, after_state TEXT NULL, INDEX (reservation_id), " +
+		"INDEX (occurred_at))",
+	"CREATE TABLE IF NOT EXISTS `audit_log_tables` (audit_id INT NOT NULL, table_id INT NOT NULL, " +
+		"PRIMARY KEY (audit_id, table_id), INDEX (table_id), FOREIGN KEY (audit_id) REFERENCES audit_log(id))",
+	"CREATE TABLE IF NOT EXISTS `webhooks` (`id` INT NOT NULL auto_increment, PRIMARY KEY (`id`), " +
+		"url VARCHAR(2048) NOT NULL, event_type VARCHAR(50) NOT NULL, secret VARCHAR(100) NOT NULL, " +
+		"active BOOLEAN NOT NULL DEFAULT TRUE, INDEX (event_type))",
+	"CREATE TABLE IF NOT EXISTS `webhook_outbox` (`id` INT NOT NULL auto_increment, PRIMARY KEY (`id`), " +
+		"webhook_id INT NOT NULL, event_type VARCHAR(50) NOT NULL, payload TEXT NOT NULL, created_at bigint NOT NULL, " +
+		"attempts int NOT NULL DEFAULT 0, next_attempt_at bigint NULL, delivered_at bigint NULL, " +
+		"INDEX (next_attempt_at), FOREIGN KEY (webhook_id) REFERENCES webhooks(id))",
+	"CREATE TABLE IF NOT EXISTS `webhook_deliveries` (`id` INT NOT NULL auto_increment, PRIMARY KEY (`id`), " +
+		"message_id INT NOT NULL, attempt int NOT NULL, attempted_at bigint NOT NULL, status_code int NOT NULL, " +
+		"error VARCHAR(255) NOT NULL DEFAULT '', duration_ms bigint NOT NULL, delivered BOOLEAN NOT NULL, " +
+		"FOREIGN KEY (message_id) REFERENCES webhook_outbox(id))",
+	"CREATE TABLE IF NOT EXISTS `notifications` (`id` INT NOT NULL auto_increment, PRIMARY KEY (`id`), " +
+		"reservation_id INT NOT NULL, kind VARCHAR(30) NOT NULL, recipient VARCHAR(255) NOT NULL, " +
+		"payload TEXT NOT NULL, created_at bigint NOT NULL, attempts int NOT NULL DEFAULT 0, " +
+		"next_attempt_at bigint NULL, sent_at bigint NULL, last_error VARCHAR(255) NOT NULL DEFAULT '', " +
+		"INDEX (reservation_id), INDEX (next_attempt_at))",
+}
+
+// guestColumns are the columns added to guestsList since its first version,
+// in the order of dump.sql, each with what else comes with it.
+var guestColumns = []struct {
+	name       string
+	definition string
+	extra      string
+}{
+	{"table_group_id", "INT NULL", "ADD FOREIGN KEY (table_group_id) REFERENCES table_groups(id)"},
+	{"rsvp_token", "VARCHAR(64) NULL UNIQUE", ""},
+	{"invited", "BOOLEAN NOT NULL DEFAULT FALSE", ""},
+	{"confirmation_code", "CHAR(6) NULL UNIQUE", ""},
+	{"checkin_used_at", "bigint NULL", ""},
+	{"dietary_needs", "VARCHAR(255) NOT NULL DEFAULT ''", ""},
+	{"diet", "VARCHAR(20) NOT NULL DEFAULT ''", ""},
+	{"gluten_free", "BOOLEAN NOT NULL DEFAULT FALSE", ""},
+	{"nut_allergy", "BOOLEAN NOT NULL DEFAULT FALSE", ""},
+	{"email", "VARCHAR(255) NOT NULL DEFAULT ''", ""},
+}
+
+// Migrate brings the schema of a database made by an older version up to
+// date: it creates the missing tables and columns, gives the reservations made
+// before then their token and confirmation code, and records the table each
+// party holding seats booked them at. Every step checks first, so it can run
+// on every start; BackfillSeats then books the seats themselves.
+func (m *mysqlGuestRepo) Migrate(ctx context.Context) error {
+	for _, stmt := range schema {
+		if _, err := m.Conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	for _, c := range guestColumns {
+		var n int
+		err := m.Conn.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM information_schema.columns "+
+				"WHERE table_schema = DATABASE() AND table_name = 'guestsList' AND column_name = ?", c.name).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		stmt := "ALTER TABLE guestsList ADD COLUMN " + c.name + " " + c.definition
+		if c.extra != "" {
+			stmt += ", " + c.extra
+		}
+		if _, err = m.Conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("adding guestsList.%s: %v", c.name, err)
+		}
+		log.Printf("added the column guestsList.%s", c.name)
+	}
+
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = fillReservationKeys(ctx, tx); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO reservation_tables(reservation_id, table_id, seats, position) "+
+			"SELECT g.id, g.table_id, g.accompanying_guests, 0 FROM guestsList g "+
+			"WHERE g.status IN (?, ?) AND g.table_id IS NOT NULL AND g.accompanying_guests > 0 AND NOT EXISTS "+
+			"(SELECT 1 FROM reservation_tables rt WHERE rt.reservation_id = g.id)",
+		models.Upcoming, models.Attended)
+	if err != nil {
+		return err
+	}
+	return m.commit(tx)
+}
+
+// fillReservationKeys gives the reservations without one a token and a
+// confirmation code.
+func fillReservationKeys(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id FROM guestsList WHERE rsvp_token IS NULL OR confirmation_code IS NULL ORDER BY id FOR UPDATE")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		token, err := newReservationToken()
+		if err != nil {
+			return err
+		}
+		code, err := uniqueConfirmationCode(ctx, tx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE guestsList SET rsvp_token = COALESCE(rsvp_token, ?), confirmation_code = COALESCE(confirmation_code, ?) "+
+				"WHERE id = ?", token, code, id)
+		if err != nil {
+			return err
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("gave %d reservations a token and a confirmation code", len(ids))
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"strings"
+	"time"
+)
+
+const maxNotificationError = 255
+
+// notificationKind is the notification a guest gets for a change of their
+// reservation, "" for none. A sync only tells them when it moved them.
+func notificationKind(action string, before, after *models.ReservationState) string {
+	switch action {
+	case models.AuditReservationCreated, models.AuditAccepted:
+		return models.NotifyBookingConfirmed
+	case models.AuditMoved:
+		return models.NotifyTableChanged
+	case models.AuditSynced:
+		if before != nil && !sameTables(stateTables(before), stateTables(after)) {
+			return models.NotifyTableChanged
+		}
+	}
+	return ""
+}
+
+// sameTables tells whether two sorted lists of table ids are equal.
+func sameTables(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// enqueueNotification puts a notification for a reservation in the outbox, in
+// the transaction of the change it is about. Reservations without an email
+// address get none.
+func (m *mysqlGuestRepo) enqueueNotification(ctx context.Context, tx *sql.Tx, kind string,
+	state *models.ReservationState) error {
+	var email string
+	err := tx.QueryRowContext(ctx, "SELECT email FROM guestsList WHERE id = ?", state.Id).Scan(&email)
+	if err != nil || email == "" {
+		return err
+	}
+	tables := state.Tables
+	if len(tables) < 2 {
+		tables = nil
+	}
+	data := models.NotificationData{Name: state.Name, Tables: models.TableNumbers(state.TableId, tables),
+		PartySize: state.AccompanyingGuests, ConfirmationCode: state.ConfirmationCode}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Unix()
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO notifications(reservation_id, kind, recipient, payload, created_at, attempts, next_attempt_at) "+
+			"VALUES (?, ?, ?, ?, ?, 0, ?)",
+		state.Id, kind, email, string(payload), now, now)
+	return err
+}
+
+// QueueReminders queues a reminder for every reservation holding seats that
+// has an email address and was not reminded yet, and returns how many.
+func (m *mysqlGuestRepo) QueueReminders(ctx context.Context) (int, error) {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT g.id FROM guestsList g WHERE g.status IN (?, ?) AND g.email <> '' AND NOT EXISTS "+
+			"(SELECT 1 FROM notifications n WHERE n.reservation_id = g.id AND n.kind = ?) ORDER BY g.id FOR UPDATE",
+		models.Upcoming, models.Attended, models.NotifyReminder)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		state, err := m.reservationState(ctx, tx, id)
+		if err != nil {
+			return 0, err
+		}
+		if err = m.enqueueNotification(ctx, tx, models.NotifyReminder, state); err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// GetNotifications returns the notifications of a reservation, or of all
+// reservations for 0, oldest first.
+func (m *mysqlGuestRepo) GetNotifications(ctx context.Context, reservationId int64) (*models.NotificationList, error) {
+	query := "SELECT id, reservation_id, kind, recipient, attempts, created_at, next_attempt_at, COALESCE(sent_at, 0), " +
+		"last_error FROM notifications"
+	var args []interface{}
+	if reservationId != 0 {
+		query += " WHERE reservation_id = ?"
+		args = append(args, reservationId)
+	}
+	rows, err := m.Conn.QueryContext(ctx, query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var nNext sql.NullInt64
+		if err := rows.Scan(&n.Id, &n.ReservationId, &n.Kind, &n.Recipient, &n.Attempts, &n.CreatedAt, &nNext, &n.SentAt,
+			&n.LastError); err != nil {
+			return nil, err
+		}
+		switch {
+		case n.SentAt != 0:
+			n.Status = "sent"
+		case nNext.Valid:
+			n.Status = "pending"
+		default:
+			n.Status = "failed"
+		}
+		notifications = append(notifications, n)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return &models.NotificationList{Notifications: notifications}, nil
+}
+
+// ClaimNotifications returns up to limit notifications due to be sent and
+// holds them back from other claims for lease.
+func (m *mysqlGuestRepo) ClaimNotifications(ctx context.Context, now time.Time, lease time.Duration,
+	limit int) ([]models.Notification, error) {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id, reservation_id, kind, recipient, payload, attempts FROM notifications "+
+			"WHERE next_attempt_at <= ? ORDER BY id LIMIT ? FOR UPDATE",
+		now.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []models.Notification
+	for rows.Next() {
+		var n models.Notification
+		var payload string
+		if err := rows.Scan(&n.Id, &n.ReservationId, &n.Kind, &n.Recipient, &payload, &n.Attempts); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(payload), &n.Data); err != nil {
+			return nil, err
+		}
+		n.Status = "pending"
+		notifications = append(notifications, n)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(notifications) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]interface{}, len(notifications))
+	for i, n := range notifications {
+		ids[i] = n.Id
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE notifications SET next_attempt_at = ? WHERE id IN (?"+strings.Repeat(", ?", len(ids)-1)+")",
+		append([]interface{}{now.Add(lease).Unix()}, ids...)...)
+	if err != nil {
+		return nil, err
+	}
+	return notifications, tx.Commit()
+}
+
+// RecordNotificationAttempt notes the outcome of one attempt to send a
+// notification: sent without sendErr, otherwise tried again at retryAt, or
+// given up when retryAt is zero.
+func (m *mysqlGuestRepo) RecordNotificationAttempt(ctx context.Context, id int64, attempt int, sendErr error,
+	attemptedAt, retryAt time.Time) error {
+	var err error
+	switch {
+	case sendErr == nil:
+		_, err = m.Conn.ExecContext(ctx,
+			"UPDATE notifications SET attempts = ?, next_attempt_at = NULL, sent_at = ?, last_error = '' WHERE id = ?",
+			attempt, attemptedAt.Unix(), id)
+	default:
+		msg := sendErr.Error()
+		if len(msg) > maxNotificationError {
+			msg = msg[:maxNotificationError]
+		}
+		next := sql.NullInt64{Int64: retryAt.Unix(), Valid: !retryAt.IsZero()}
+		_, err = m.Conn.ExecContext(ctx,
+			"UPDATE notifications SET attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?",
+			attempt, next, msg, id)
+	}
+	return err
+}
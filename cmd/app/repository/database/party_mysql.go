@@ -0,0 +1,256 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository"
+	"log"
+)
+
+func (m *mysqlGuestRepo) GetPartyMembers(ctx context.Context, name string) (*models.PartyMemberList, error) {
+	tx, err := m.Conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.readReservation(ctx, tx, name)
+	if err != nil {
+		return nil, err
+	}
+	members, err := m.getPartyMembers(ctx, tx, reservation.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &models.PartyMemberList{Members: members}, nil
+}
+
+// AddPartyMember names one more accompanying guest. Guest 0 is the main guest,
+// so the roster holds at most accompanying_guests - 1 members: while there is
+// room the member fills one of the places already booked, otherwise the party
+// grows by one seat.
+func (m *mysqlGuestRepo) AddPartyMember(ctx context.Context, name string, member *models.PartyMember) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getEditableReservation(ctx, tx, name)
+	if err != nil {
+		return err
+	}
+	before, err := m.reservationState(ctx, tx, reservation.Id)
+	if err != nil {
+		return err
+	}
+	size, err := m.rosterSize(ctx, tx, reservation.Id)
+	if err != nil {
+		return err
+	}
+	if size+1 >= reservation.AccompanyingGuests {
+		if reservation.Status.HoldsSeats() {
+			tableIds, err := m.candidateTables(ctx, tx, reservation.TableId, reservation.TableGroupId)
+			if err != nil {
+				return err
+			}
+			if err = m.allocateSeats(ctx, tx, reservation.Id, tableIds, 1); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE guestsList SET accompanying_guests = accompanying_guests + 1 where id = ?", reservation.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO party_members(reservation_id, name, dietary_needs, age_group, accessibility, "+
+			"diet, gluten_free, nut_allergy) VALUES (?, ?, ?, ?, ?, ?, ?, ?);",
+		reservation.Id, member.Name, member.DietaryNeeds, member.AgeGroup, member.Accessibility,
+		member.Diet, member.GlutenFree, member.NutAllergy)
+	if err != nil {
+		return err
+	}
+	memberId, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err = m.auditReservation(ctx, tx, models.AuditMemberAdded, reservation.Id, before); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+
+	member.Id = memberId
+	member.ReservationId = reservation.Id
+	log.Printf("party member id=%v was added to reservation id=%v", memberId, reservation.Id)
+	return nil
+}
+
+func (m *mysqlGuestRepo) UpdatePartyMember(ctx context.Context, name string, member *models.PartyMember) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getEditableReservation(ctx, tx, name)
+	if err != nil {
+		return err
+	}
+	before, err := m.reservationState(ctx, tx, reservation.Id)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx,
+		"UPDATE party_members SET name = ?, dietary_needs = ?, age_group = ?, accessibility = ?, "+
+			"diet = ?, gluten_free = ?, nut_allergy = ? WHERE id = ? AND reservation_id = ?",
+		member.Name, member.DietaryNeeds, member.AgeGroup, member.Accessibility,
+		member.Diet, member.GlutenFree, member.NutAllergy, member.Id, reservation.Id)
+	if err != nil {
+		return err
+	}
+	if err = m.memberFound(ctx, tx, res, member.Id, reservation.Id); err != nil {
+		return err
+	}
+	if err = m.auditReservation(ctx, tx, models.AuditMemberUpdated, reservation.Id, before); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+
+	member.ReservationId = reservation.Id
+	return nil
+}
+
+// RemovePartyMember takes a named guest off the roster; the party shrinks by
+// one and the seat is given back, unless the roster had outgrown the party,
+// in which case the place stays booked.
+func (m *mysqlGuestRepo) RemovePartyMember(ctx context.Context, name string, memberId int64) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getEditableReservation(ctx, tx, name)
+	if err != nil {
+		return err
+	}
+	before, err := m.reservationState(ctx, tx, reservation.Id)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx,
+		"DELETE FROM party_members WHERE id = ? AND reservation_id = ?", memberId, reservation.Id)
+	if err != nil {
+		return err
+	}
+	if err = m.memberFound(ctx, tx, res, memberId, reservation.Id); err != nil {
+		return err
+	}
+	size, err := m.rosterSize(ctx, tx, reservation.Id)
+	if err != nil {
+		return err
+	}
+	if size+1 < reservation.AccompanyingGuests {
+		if reservation.Status.HoldsSeats() {
+			if err = m.releaseSeats(ctx, tx, reservation.Id, 1); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE guestsList SET accompanying_guests = accompanying_guests - 1 where id = ?", reservation.Id)
+		if err != nil {
+			return err
+		}
+	}
+	if err = m.auditReservation(ctx, tx, models.AuditMemberRemoved, reservation.Id, before); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+
+	log.Printf("party member id=%v was removed from reservation id=%v", memberId, reservation.Id)
+	return nil
+}
+
+func (m *mysqlGuestRepo) getEditableReservation(ctx context.Context, tx *sql.Tx, name string) (*models.GuestsReservation, error) {
+	reservation, err := m.getReservation(ctx, tx, name)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.Status == models.Archived {
+		return nil, fmt.Errorf("reservation for %s is archived", name)
+	}
+	return reservation, nil
+}
+
+// memberFound tells an UPDATE that matched no row apart from one that left the
+// row unchanged, which MySQL reports the same way.
+func (m *mysqlGuestRepo) memberFound(ctx context.Context, tx *sql.Tx, res sql.Result, memberId, reservationId int64) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	var id int64
+	err = tx.QueryRowContext(ctx,
+		"SELECT id FROM party_members WHERE id = ? AND reservation_id = ?", memberId, reservationId).Scan(&id)
+	if err == sql.ErrNoRows {
+		return repository.ErrNoSuchMember
+	}
+	return err
+}
+
+// checkRoster refuses a party of accompanyingGuests that leaves no place for
+// the main guest, guest 0, beside its named guests.
+func (m *mysqlGuestRepo) checkRoster(ctx context.Context, tx *sql.Tx, reservation *models.GuestsReservation,
+	accompanyingGuests int64) error {
+	size, err := m.rosterSize(ctx, tx, reservation.Id)
+	if err != nil {
+		return err
+	}
+	if size > 0 && accompanyingGuests <= size {
+		return fmt.Errorf("%w: the party of %s has %v named guests", repository.ErrRosterTooLarge, reservation.Name, size)
+	}
+	return nil
+}
+
+func (m *mysqlGuestRepo) rosterSize(ctx context.Context, tx *sql.Tx, reservationId int64) (int64, error) {
+	var size int64
+	err := tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM party_members WHERE reservation_id = ?", reservationId).Scan(&size)
+	return size, err
+}
+
+func (m *mysqlGuestRepo) getPartyMembers(ctx context.Context, tx *sql.Tx, reservationId int64) ([]models.PartyMember, error) {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id, reservation_id, name, dietary_needs, age_group, accessibility, diet, gluten_free, nut_allergy "+
+			"FROM party_members "+
+			"WHERE reservation_id = ? ORDER BY id", reservationId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []models.PartyMember
+	for rows.Next() {
+		var p models.PartyMember
+		if err := rows.Scan(&p.Id, &p.ReservationId, &p.Name, &p.DietaryNeeds, &p.AgeGroup, &p.Accessibility,
+			&p.Diet, &p.GlutenFree, &p.NutAllergy); err != nil {
+			return nil, err
+		}
+		members = append(members, p)
+	}
+	return members, rows.Err()
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository"
+	"log"
+)
+
+// newReservationToken returns the secret a guest uses to manage their own
+// reservation.
+func newReservationToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (m *mysqlGuestRepo) GetReservationByToken(ctx context.Context, token string) (*models.PortalReservation, error) {
+	tx, err := m.Conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getReservationByToken(ctx, tx, m.readReservationBy, token)
+	if err != nil {
+		return nil, err
+	}
+	members, err := m.getPartyMembers(ctx, tx, reservation.Id)
+	if err != nil {
+		return nil, err
+	}
+	if members == nil {
+		members = []models.PartyMember{}
+	}
+	tables, err := m.getSplitAllocations(ctx, tx, reservation.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &models.PortalReservation{
+		Id:                  reservation.Id,
+		Name:                reservation.Name,
+		ConfirmationCode:    reservation.ConfirmationCode,
+		TableId:             reservation.TableId,
+		Tables:              tables,
+		AccompanyingGuests:  reservation.AccompanyingGuests,
+		Status:              reservation.Status,
+		DietaryNeeds:        reservation.DietaryNeeds,
+		DietaryRequirements: reservation.DietaryRequirements,
+		Members:             members,
+	}, nil
+}
+
+// ChangePartySize changes the number of accompanying guests. Once seats are
+// booked the difference is booked or given back on the party's tables.
+func (m *mysqlGuestRepo) ChangePartySize(ctx context.Context, token string, accompanyingGuests int64) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getReservationByToken(ctx, tx, m.getReservationBy, token)
+	if err != nil {
+		return err
+	}
+	if reservation.Status != models.Invited && reservation.Status != models.Upcoming {
+		return repository.ErrReservationClosed
+	}
+	if err = m.resizeParty(ctx, tx, reservation, accompanyingGuests); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+	log.Printf("reservation id=%v now has %v accompanying guests", reservation.Id, accompanyingGuests)
+	return nil
+}
+
+func (m *mysqlGuestRepo) UpdateDietaryRequirements(ctx context.Context, token string, dietary *models.PortalReservation) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getReservationByToken(ctx, tx, m.getReservationBy, token)
+	if err != nil {
+		return err
+	}
+	if reservation.Status == models.Archived || reservation.Status == models.Cancelled {
+		return repository.ErrReservationClosed
+	}
+	before, err := m.reservationState(ctx, tx, reservation.Id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE guestsList SET dietary_needs = ?, diet = ?, gluten_free = ?, nut_allergy = ? where id = ?",
+		dietary.DietaryNeeds, dietary.Diet, dietary.GlutenFree, dietary.NutAllergy, reservation.Id)
+	if err != nil {
+		return err
+	}
+	if err = m.auditReservation(ctx, tx, models.AuditDietaryUpdated, reservation.Id, before); err != nil {
+		return err
+	}
+	return m.commit(tx)
+}
+
+// CancelReservation is the guest calling off their own reservation; any
+// booked seats are given back.
+func (m *mysqlGuestRepo) CancelReservation(ctx context.Context, token string) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getReservationByToken(ctx, tx, m.getReservationBy, token)
+	if err != nil {
+		return err
+	}
+	if err = m.cancel(ctx, tx, reservation); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+	log.Printf("reservation id=%v was cancelled by the guest", reservation.Id)
+	return nil
+}
+
+func (m *mysqlGuestRepo) cancel(ctx context.Context, tx *sql.Tx, reservation *models.GuestsReservation) error {
+	if reservation.Status != models.Invited && reservation.Status != models.Upcoming {
+		return repository.ErrReservationClosed
+	}
+	before, err := m.reservationState(ctx, tx, reservation.Id)
+	if err != nil {
+		return err
+	}
+	if err = m.releaseAllSeats(ctx, tx, reservation.Id); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE guestsList SET status = ? where id = ?", models.Cancelled, reservation.Id)
+	if err != nil {
+		return err
+	}
+	return m.auditReservation(ctx, tx, models.AuditCancelled, reservation.Id, before)
+}
+
+func (m *mysqlGuestRepo) getReservationByToken(ctx context.Context, tx *sql.Tx, lookup reservationLookup,
+	token string) (*models.GuestsReservation, error) {
+	reservation, err := lookup(ctx, tx, "rsvp_token", token)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrUnknownToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	reservation.RsvpToken = token
+	return reservation, nil
+}
@@ -0,0 +1,271 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository"
+	"log"
+)
+
+// CreateInvitation adds an invitee to the guest list without booking any
+// seats; they are booked when the invitation is accepted.
+func (m *mysqlGuestRepo) CreateInvitation(ctx context.Context, guest *models.GuestsReservation) error {
+	token, err := newReservationToken()
+	if err != nil {
+		return err
+	}
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	code, err := uniqueConfirmationCode(ctx, tx)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO guestsList(table_id, table_group_id, name, accompanying_guests, status, rsvp_token, invited, "+
+			"confirmation_code, dietary_needs, diet, gluten_free, nut_allergy, email) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);",
+		sql.NullInt32{Int32: guest.TableId, Valid: guest.TableId != 0}, nullGroupId(guest.TableGroupId),
+		guest.Name, guest.AccompanyingGuests, models.Invited, token, true, code,
+		guest.DietaryNeeds, guest.Diet, guest.GlutenFree, guest.NutAllergy, guest.Email)
+	if err != nil {
+		return err
+	}
+	invitationId, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err = m.auditReservation(ctx, tx, models.AuditInvited, invitationId, nil); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+
+	guest.Id = invitationId
+	guest.Status = models.Invited
+	guest.RsvpToken = token
+	guest.ConfirmationCode = code
+	log.Printf("New invitation id=%v was added", invitationId)
+	return nil
+}
+
+// GetInvitations lists the invitations without their tokens, which only the
+// invitee gets: a token opens the guest's own routes, that need no role.
+func (m *mysqlGuestRepo) GetInvitations(ctx context.Context) (*models.GuestList, error) {
+	rows, err := m.Conn.QueryContext(ctx,
+		"SELECT g.id, g.table_id, g.name, g.accompanying_guests, g.status FROM guestsList g "+
+			"where g.invited ORDER BY g.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []models.GuestsReservation
+	for rows.Next() {
+		var r models.GuestsReservation
+		var nTable sql.NullInt32
+		if err := rows.Scan(&r.Id, &nTable, &r.Name, &r.AccompanyingGuests, &r.Status); err != nil {
+			return nil, err
+		}
+		r.TableId = nTable.Int32
+		invitations = append(invitations, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return &models.GuestList{Guests: invitations}, nil
+}
+
+func (m *mysqlGuestRepo) GetInvitation(ctx context.Context, token string) (*models.GuestsReservation, error) {
+	tx, err := m.Conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return m.getInvitation(ctx, tx, m.readReservationBy, token)
+}
+
+// AcceptInvitation books the seats of an invitee at the table staff chose for
+// the invitation. The answer can change the party size, never the table.
+func (m *mysqlGuestRepo) AcceptInvitation(ctx context.Context, token string, guest *models.GuestsReservation) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	invitation, err := m.getInvitation(ctx, tx, m.getReservationBy, token)
+	if err != nil {
+		return err
+	}
+	if invitation.Status != models.Invited && invitation.Status != models.Declined {
+		return repository.ErrInvitationClosed
+	}
+	before, err := m.reservationState(ctx, tx, invitation.Id)
+	if err != nil {
+		return err
+	}
+	if guest.AccompanyingGuests > 0 {
+		invitation.AccompanyingGuests = guest.AccompanyingGuests
+	}
+	if invitation.TableId == 0 && invitation.TableGroupId == 0 {
+		return fmt.Errorf("%w for %s", repository.ErrNoTableChosen, invitation.Name)
+	}
+	if err = m.checkRoster(ctx, tx, invitation, invitation.AccompanyingGuests); err != nil {
+		return err
+	}
+
+	tableIds, err := m.candidateTables(ctx, tx, invitation.TableId, invitation.TableGroupId)
+	if err != nil {
+		return err
+	}
+	if err = m.allocateSeats(ctx, tx, invitation.Id, tableIds, invitation.AccompanyingGuests); err != nil {
+		log.Printf("cannot seat invitation id=%v, tables=%v: %v", invitation.Id, tableIds, err)
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE guestsList SET table_id = ?, table_group_id = ?, accompanying_guests = ?, status = ? where id = ?",
+		tableIds[0], nullGroupId(invitation.TableGroupId), invitation.AccompanyingGuests, models.Upcoming, invitation.Id)
+	if err != nil {
+		return err
+	}
+	if err = m.auditReservation(ctx, tx, models.AuditAccepted, invitation.Id, before); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+
+	*guest = *invitation
+	guest.TableId = tableIds[0]
+	guest.Status = models.Upcoming
+	log.Printf("invitation id=%v was accepted", invitation.Id)
+	return nil
+}
+
+// DeclineInvitation turns an invitation down, giving back the seats if it had
+// already been accepted.
+func (m *mysqlGuestRepo) DeclineInvitation(ctx context.Context, token string) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	invitation, err := m.getInvitation(ctx, tx, m.getReservationBy, token)
+	if err != nil {
+		return err
+	}
+	before, err := m.reservationState(ctx, tx, invitation.Id)
+	if err != nil {
+		return err
+	}
+	switch invitation.Status {
+	case models.Invited:
+	case models.Upcoming:
+		if err = m.releaseAllSeats(ctx, tx, invitation.Id); err != nil {
+			return err
+		}
+	case models.Declined:
+		return nil
+	default:
+		return repository.ErrInvitationClosed
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE guestsList SET status = ? where id = ?", models.Declined, invitation.Id)
+	if err != nil {
+		return err
+	}
+	if err = m.auditReservation(ctx, tx, models.AuditDeclined, invitation.Id, before); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+	log.Printf("invitation id=%v was declined", invitation.Id)
+	return nil
+}
+
+// ChangeInvitation changes the number of plus-ones. Once the invitation is
+// accepted the difference is booked or given back on the party's tables.
+func (m *mysqlGuestRepo) ChangeInvitation(ctx context.Context, token string, accompanyingGuests int64) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	invitation, err := m.getInvitation(ctx, tx, m.getReservationBy, token)
+	if err != nil {
+		return err
+	}
+	if invitation.Status != models.Invited && invitation.Status != models.Upcoming {
+		return repository.ErrInvitationClosed
+	}
+	if err = m.resizeParty(ctx, tx, invitation, accompanyingGuests); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+	log.Printf("invitation id=%v now has %v accompanying guests", invitation.Id, accompanyingGuests)
+	return nil
+}
+
+// resizeParty sets the number of accompanying guests of a reservation,
+// booking or giving back the difference when it holds seats.
+func (m *mysqlGuestRepo) resizeParty(ctx context.Context, tx *sql.Tx, reservation *models.GuestsReservation,
+	accompanyingGuests int64) error {
+	if err := m.checkRoster(ctx, tx, reservation, accompanyingGuests); err != nil {
+		return err
+	}
+	before, err := m.reservationState(ctx, tx, reservation.Id)
+	if err != nil {
+		return err
+	}
+
+	diff := accompanyingGuests - reservation.AccompanyingGuests
+	if reservation.Status.HoldsSeats() && diff > 0 {
+		tableIds, err := m.candidateTables(ctx, tx, reservation.TableId, reservation.TableGroupId)
+		if err != nil {
+			return err
+		}
+		if err = m.allocateSeats(ctx, tx, reservation.Id, tableIds, diff); err != nil {
+			return err
+		}
+	}
+	if reservation.Status.HoldsSeats() && diff < 0 {
+		if err = m.releaseSeats(ctx, tx, reservation.Id, -diff); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE guestsList SET accompanying_guests = ? where id = ?",
+		accompanyingGuests, reservation.Id)
+	if err != nil {
+		return err
+	}
+	if err = m.auditReservation(ctx, tx, models.AuditResized, reservation.Id, before); err != nil {
+		return err
+	}
+	reservation.AccompanyingGuests = accompanyingGuests
+	return nil
+}
+
+func (m *mysqlGuestRepo) getInvitation(ctx context.Context, tx *sql.Tx, lookup reservationLookup,
+	token string) (*models.GuestsReservation, error) {
+	invitation, err := lookup(ctx, tx, "rsvp_token", token)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNoSuchInvitation
+	}
+	if err != nil {
+		return nil, err
+	}
+	invitation.RsvpToken = token
+	return invitation, nil
+}
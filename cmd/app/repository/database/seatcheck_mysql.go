@@ -0,0 +1,372 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"log"
+	"sort"
+)
+
+// seatState is what the seat accounting is made of: the counters on tables,
+// the reservations, the seats they hold and the allocations recorded for
+// them, each per reservation and table.
+type seatState struct {
+	tables       []models.Table
+	reservations map[int64]*models.GuestsReservation
+	held         map[int64]map[int64]int64
+	allocated    map[int64]map[int64]int64
+}
+
+// CheckSeats recomputes what every table's counters should be from the
+// reservations that hold seats, and reports each stored count that differs.
+func (m *mysqlGuestRepo) CheckSeats(ctx context.Context) (*models.SeatCheckReport, error) {
+	tx, err := m.Conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	state, err := loadSeatState(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	return state.report(), nil
+}
+
+// RepairSeats makes the seats, allocations and counters agree with the
+// reservations again, in one transaction. Seats held by reservations that
+// hold none any more are freed, allocations follow the seats, and parties
+// holding too many or too few seats are trimmed or topped up at their tables.
+// Nothing is kept unless the result checks out.
+func (m *mysqlGuestRepo) RepairSeats(ctx context.Context) (*models.SeatCheckReport, error) {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	state, err := loadSeatState(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	report := state.report()
+	if len(report.Discrepancies) == 0 {
+		return report, nil
+	}
+	var repairedIds []int64
+	before := map[int64]*models.ReservationState{}
+	for _, d := range report.Discrepancies {
+		if id := d.ReservationId; state.reservations[id] != nil && before[id] == nil {
+			if before[id], err = m.reservationState(ctx, tx, id); err != nil {
+				return nil, err
+			}
+			repairedIds = append(repairedIds, id)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE seats SET reservation_id = NULL, guest_index = NULL WHERE reservation_id IS NOT NULL AND "+
+			"reservation_id NOT IN (SELECT id FROM guestsList WHERE status IN (?, ?))",
+		models.Upcoming, models.Attended)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM reservation_tables WHERE reservation_id NOT IN (SELECT id FROM guestsList WHERE status IN (?, ?))",
+		models.Upcoming, models.Attended)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range state.reservationIds() {
+		if r := state.reservations[id]; r != nil && r.Status.HoldsSeats() {
+			if err = m.matchAllocations(ctx, tx, id, state.held[id], state.allocated[id]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, t := range state.tables {
+		if err = m.syncTableCounters(ctx, tx, int32(t.Id)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range state.reservationIds() {
+		r := state.reservations[id]
+		if r == nil || !r.Status.HoldsSeats() {
+			continue
+		}
+		held := sum(state.held[id])
+		if held > r.AccompanyingGuests {
+			err = m.releaseSeats(ctx, tx, id, held-r.AccompanyingGuests)
+		} else if held < r.AccompanyingGuests {
+			var tableIds []int32
+			tableIds, err = m.candidateTables(ctx, tx, r.TableId, r.TableGroupId)
+			if err == nil {
+				err = m.allocateSeats(ctx, tx, id, tableIds, r.AccompanyingGuests-held)
+			}
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("reservation %d (%s): %v", id, r.Name, err))
+		}
+	}
+	if len(report.Errors) > 0 {
+		return report, nil
+	}
+
+	if state, err = loadSeatState(ctx, tx); err != nil {
+		return nil, err
+	}
+	if left := state.report().Discrepancies; len(left) > 0 {
+		report.Errors = append(report.Errors, fmt.Sprintf("%d discrepancies are left after the repair", len(left)))
+		return report, nil
+	}
+	if err = m.auditRepair(ctx, tx, report.Discrepancies, repairedIds, before); err != nil {
+		return nil, err
+	}
+	if err = m.commit(tx); err != nil {
+		return nil, err
+	}
+	report.Repaired = true
+	log.Printf("seat accounting repaired, %v discrepancies fixed", len(report.Discrepancies))
+	return report, nil
+}
+
+// auditRepair records the discrepancies a repair fixed, then the change of
+// every reservation that had one.
+func (m *mysqlGuestRepo) auditRepair(ctx context.Context, tx *sql.Tx, discrepancies []models.SeatDiscrepancy,
+	reservationIds []int64, before map[int64]*models.ReservationState) error {
+	var tableIds []int64
+	seen := map[int64]bool{}
+	for _, d := range discrepancies {
+		if d.TableId != 0 && !seen[d.TableId] {
+			seen[d.TableId] = true
+			tableIds = append(tableIds, d.TableId)
+		}
+	}
+	entry := models.AuditEntry{Action: models.AuditSeatsRepaired, TableIds: tableIds}
+	if err := m.record(ctx, tx, entry, discrepancies, nil); err != nil {
+		return err
+	}
+	for _, id := range reservationIds {
+		if err := m.auditReservation(ctx, tx, models.AuditSeatsRepaired, id, before[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchAllocations rewrites the allocations of a reservation so that they
+// count the seats it actually holds at each table.
+func (m *mysqlGuestRepo) matchAllocations(ctx context.Context, tx *sql.Tx, reservationId int64,
+	held map[int64]int64, allocated map[int64]int64) error {
+	position := len(allocated)
+	for _, tableId := range unionKeys(held, allocated) {
+		h, a := held[tableId], allocated[tableId]
+		var err error
+		switch {
+		case h == a:
+			continue
+		case h == 0:
+			_, err = tx.ExecContext(ctx, "DELETE FROM reservation_tables WHERE reservation_id = ? AND table_id = ?",
+				reservationId, tableId)
+		case a == 0:
+			_, err = tx.ExecContext(ctx,
+				"INSERT INTO reservation_tables(reservation_id, table_id, seats, position) VALUES (?, ?, ?, ?)",
+				reservationId, tableId, h, position)
+			position++
+		default:
+			_, err = tx.ExecContext(ctx, "UPDATE reservation_tables SET seats = ? WHERE reservation_id = ? AND table_id = ?",
+				h, reservationId, tableId)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadSeatState(ctx context.Context, tx *sql.Tx) (*seatState, error) {
+	state := &seatState{reservations: map[int64]*models.GuestsReservation{}, held: map[int64]map[int64]int64{},
+		allocated: map[int64]map[int64]int64{}}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, capacity, booked_seats, available_seats FROM tables ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t models.Table
+		var nCapacity, nBooked, nAvailable sql.NullInt64
+		if err := rows.Scan(&t.Id, &nCapacity, &nBooked, &nAvailable); err != nil {
+			return nil, err
+		}
+		t.Capacity, t.BookedSeats, t.AvailableSeats = int(nCapacity.Int64), int(nBooked.Int64), int(nAvailable.Int64)
+		state.tables = append(state.tables, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	reservations, err := tx.QueryContext(ctx,
+		"SELECT id, name, table_id, table_group_id, accompanying_guests, status FROM guestsList")
+	if err != nil {
+		return nil, err
+	}
+	defer reservations.Close()
+	for reservations.Next() {
+		var r models.GuestsReservation
+		var nTable sql.NullInt32
+		var nGroup, nGuests sql.NullInt64
+		if err := reservations.Scan(&r.Id, &r.Name, &nTable, &nGroup, &nGuests, &r.Status); err != nil {
+			return nil, err
+		}
+		r.TableId = nTable.Int32
+		r.TableGroupId = nGroup.Int64
+		r.AccompanyingGuests = nGuests.Int64
+		state.reservations[r.Id] = &r
+	}
+	if err = reservations.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, c := range []struct {
+		query  string
+		counts map[int64]map[int64]int64
+	}{
+		{"SELECT reservation_id, table_id, COUNT(*) FROM seats WHERE reservation_id IS NOT NULL " +
+			"GROUP BY reservation_id, table_id", state.held},
+		{"SELECT reservation_id, table_id, seats FROM reservation_tables", state.allocated},
+	} {
+		if err = scanCounts(ctx, tx, c.query, c.counts); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+func scanCounts(ctx context.Context, tx *sql.Tx, query string, counts map[int64]map[int64]int64) error {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reservationId, tableId, n int64
+		if err := rows.Scan(&reservationId, &tableId, &n); err != nil {
+			return err
+		}
+		if counts[reservationId] == nil {
+			counts[reservationId] = map[int64]int64{}
+		}
+		counts[reservationId][tableId] += n
+	}
+	return rows.Err()
+}
+
+// report lists every discrepancy. A table is expected to have booked the seats
+// allocated to the reservations that hold seats; such a reservation is
+// expected to hold one seat per accompanying guest, and any other none.
+func (s *seatState) report() *models.SeatCheckReport {
+	report := &models.SeatCheckReport{TablesChecked: len(s.tables), ReservationsChecked: len(s.reservations),
+		Discrepancies: []models.SeatDiscrepancy{}}
+	add := func(d models.SeatDiscrepancy) {
+		report.Discrepancies = append(report.Discrepancies, d)
+	}
+
+	expected := map[int64]int64{}
+	heldAt := map[int64]int64{}
+	for id, tables := range s.allocated {
+		if r := s.reservations[id]; r != nil && r.Status.HoldsSeats() {
+			for tableId, seats := range tables {
+				expected[tableId] += seats
+			}
+		}
+	}
+	for _, tables := range s.held {
+		for tableId, seats := range tables {
+			heldAt[tableId] += seats
+		}
+	}
+	for _, t := range s.tables {
+		booked, capacity := expected[t.Id], int64(t.Capacity)
+		if int64(t.BookedSeats) != booked {
+			add(models.SeatDiscrepancy{TableId: t.Id, Field: "booked_seats", Expected: booked, Actual: int64(t.BookedSeats)})
+		}
+		if int64(t.AvailableSeats) != capacity-booked {
+			add(models.SeatDiscrepancy{TableId: t.Id, Field: "available_seats", Expected: capacity - booked,
+				Actual: int64(t.AvailableSeats)})
+		}
+		if heldAt[t.Id] != booked {
+			add(models.SeatDiscrepancy{TableId: t.Id, Field: "held_seats", Expected: booked, Actual: heldAt[t.Id]})
+		}
+		if booked > capacity {
+			add(models.SeatDiscrepancy{TableId: t.Id, Field: "capacity", Expected: capacity, Actual: booked})
+		}
+	}
+
+	for _, id := range s.reservationIds() {
+		var want int64
+		if r := s.reservations[id]; r != nil && r.Status.HoldsSeats() {
+			want = r.AccompanyingGuests
+		}
+		allocated, held := sum(s.allocated[id]), sum(s.held[id])
+		if allocated != want {
+			add(models.SeatDiscrepancy{ReservationId: id, Field: "allocated_seats", Expected: want, Actual: allocated})
+		}
+		if held != want {
+			add(models.SeatDiscrepancy{ReservationId: id, Field: "held_seats", Expected: want, Actual: held})
+			continue
+		}
+		for _, tableId := range unionKeys(s.held[id], s.allocated[id]) {
+			if a, h := s.allocated[id][tableId], s.held[id][tableId]; a != h {
+				add(models.SeatDiscrepancy{ReservationId: id, TableId: tableId, Field: "held_seats", Expected: a, Actual: h})
+			}
+		}
+	}
+	return report
+}
+
+// reservationIds lists, in order, every reservation and every unknown
+// reservation id seats or allocations refer to.
+func (s *seatState) reservationIds() []int64 {
+	seen := map[int64]bool{}
+	for id := range s.reservations {
+		seen[id] = true
+	}
+	for id := range s.held {
+		seen[id] = true
+	}
+	for id := range s.allocated {
+		seen[id] = true
+	}
+	ids := make([]int64, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func unionKeys(a, b map[int64]int64) []int64 {
+	var keys []int64
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func sum(counts map[int64]int64) int64 {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
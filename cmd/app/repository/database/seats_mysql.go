@@ -0,0 +1,605 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository"
+	"log"
+)
+
+func nullGroupId(groupId int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: groupId, Valid: groupId != 0}
+}
+
+func (m *mysqlGuestRepo) CreateTableGroup(ctx context.Context, group *models.TableGroup) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO table_groups(name) VALUES (?);", group.Name)
+	if err != nil {
+		return err
+	}
+	groupId, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for position, tableId := range group.TableIds {
+		if err = m.tableExists(ctx, tx, tableId); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO table_group_members(group_id, table_id, position) VALUES (?, ?, ?);",
+			groupId, tableId, position)
+		if err != nil {
+			return err
+		}
+	}
+	group.Id = groupId
+	tableIds := make([]int64, len(group.TableIds))
+	for i, id := range group.TableIds {
+		tableIds[i] = int64(id)
+	}
+	entry := models.AuditEntry{Action: models.AuditTableGroupCreated, TableIds: tableIds}
+	if err = m.record(ctx, tx, entry, nil, group); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+
+	log.Printf("New table group id=%v with tables=%v was added", groupId, group.TableIds)
+	return nil
+}
+
+func (m *mysqlGuestRepo) GetTableGroups() (*models.TableGroupList, error) {
+	rows, err := m.Conn.Query(
+		"SELECT tg.id, tg.name, m.table_id FROM table_groups tg " +
+			"JOIN table_group_members m ON m.group_id = tg.id ORDER BY tg.id, m.position")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.TableGroup
+	for rows.Next() {
+		var id int64
+		var name string
+		var tableId int32
+		if err := rows.Scan(&id, &name, &tableId); err != nil {
+			return nil, err
+		}
+		if n := len(groups); n == 0 || groups[n-1].Id != id {
+			groups = append(groups, models.TableGroup{Id: id, Name: name})
+		}
+		groups[len(groups)-1].TableIds = append(groups[len(groups)-1].TableIds, tableId)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return &models.TableGroupList{Groups: groups}, nil
+}
+
+func (m *mysqlGuestRepo) MoveReservation(ctx context.Context, guest *models.GuestsReservation) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getReservation(ctx, tx, guest.Name)
+	if err != nil {
+		return err
+	}
+	if reservation.Status == models.Archived {
+		return fmt.Errorf("reservation for %s is archived", guest.Name)
+	}
+	before, err := m.reservationState(ctx, tx, reservation.Id)
+	if err != nil {
+		return err
+	}
+
+	tableIds, err := m.candidateTables(ctx, tx, guest.TableId, guest.TableGroupId)
+	if err != nil {
+		return err
+	}
+	if reservation.Status.HoldsSeats() {
+		if err = m.releaseAllSeats(ctx, tx, reservation.Id); err != nil {
+			return err
+		}
+		if err = m.allocateSeats(ctx, tx, reservation.Id, tableIds, reservation.AccompanyingGuests); err != nil {
+			log.Printf("cannot move reservation id=%v to tables=%v: %v", reservation.Id, tableIds, err)
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE guestsList SET table_id = ?, table_group_id = ? where id = ?",
+		tableIds[0], nullGroupId(guest.TableGroupId), reservation.Id)
+	if err != nil {
+		return err
+	}
+	if err = m.auditReservation(ctx, tx, models.AuditMoved, reservation.Id, before); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+
+	guest.Id = reservation.Id
+	guest.TableId = tableIds[0]
+	log.Printf("reservation id=%v was moved to tables=%v", reservation.Id, tableIds)
+	return nil
+}
+
+// candidateTables returns the tables a reservation may be seated at, in the
+// order they should be filled: the members of the group when one is given,
+// otherwise just the single table.
+func (m *mysqlGuestRepo) candidateTables(ctx context.Context, tx *sql.Tx, tableId int32, groupId int64) ([]int32, error) {
+	if groupId == 0 {
+		if err := m.tableExists(ctx, tx, tableId); err != nil {
+			return nil, err
+		}
+		return []int32{tableId}, nil
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT table_id FROM table_group_members WHERE group_id = ? ORDER BY position", groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tableIds []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		tableIds = append(tableIds, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(tableIds) == 0 {
+		return nil, fmt.Errorf("no such table_group_id=%v", groupId)
+	}
+	return tableIds, nil
+}
+
+func (m *mysqlGuestRepo) tableExists(ctx context.Context, tx *sql.Tx, tableId int32) error {
+	var id int32
+	err := tx.QueryRowContext(ctx, "SELECT id FROM tables WHERE id = ?", tableId).Scan(&id)
+	if err == sql.ErrNoRows {
+		log.Printf("no such table with id=%v", tableId)
+		return fmt.Errorf("no such table_id=%v", tableId)
+	}
+	return err
+}
+
+// allocateSeats books seats for a reservation on the given tables, filling
+// each table before moving on to the next one. Either all seats are booked or
+// none are.
+func (m *mysqlGuestRepo) allocateSeats(ctx context.Context, tx *sql.Tx, reservationId int64, tableIds []int32, seats int64) error {
+	available := make([]int64, len(tableIds))
+	var total int64
+	for i, tableId := range tableIds {
+		err := tx.QueryRowContext(ctx,
+			"SELECT available_seats FROM tables WHERE id = ? FOR UPDATE", tableId).Scan(&available[i])
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("no such table_id=%v", tableId)
+			}
+			return err
+		}
+		total += available[i]
+	}
+	if total < seats {
+		return repository.ErrNotEnoughSeats
+	}
+
+	for i, tableId := range tableIds {
+		if seats == 0 {
+			break
+		}
+		take := available[i]
+		if take > seats {
+			take = seats
+		}
+		if take <= 0 {
+			continue
+		}
+		_, err := tx.ExecContext(ctx,
+			"UPDATE seats SET reservation_id = ?, guest_index = NULL "+
+				"WHERE table_id = ? AND reservation_id IS NULL ORDER BY position LIMIT ?",
+			reservationId, tableId, take)
+		if err != nil {
+			return err
+		}
+		if err = m.syncTableCounters(ctx, tx, tableId); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO reservation_tables(reservation_id, table_id, seats, position) VALUES (?, ?, ?, ?) "+
+				"ON DUPLICATE KEY UPDATE seats = seats + VALUES(seats)",
+			reservationId, tableId, take, i)
+		if err != nil {
+			return err
+		}
+		seats -= take
+	}
+	return nil
+}
+
+// releaseSeats gives back seats held by a reservation, emptying the tables
+// that were filled last first.
+func (m *mysqlGuestRepo) releaseSeats(ctx context.Context, tx *sql.Tx, reservationId int64, seats int64) error {
+	allocations, err := m.getSeatAllocations(ctx, tx, reservationId)
+	if err != nil {
+		return err
+	}
+	for i := len(allocations) - 1; i >= 0 && seats > 0; i-- {
+		give := allocations[i].Seats
+		if give > seats {
+			give = seats
+		}
+		if err = m.releaseFromTable(ctx, tx, reservationId, allocations[i], give); err != nil {
+			return err
+		}
+		seats -= give
+	}
+	if seats > 0 {
+		return errors.New("reservation holds fewer seats than released")
+	}
+	return nil
+}
+
+func (m *mysqlGuestRepo) releaseAllSeats(ctx context.Context, tx *sql.Tx, reservationId int64) error {
+	allocations, err := m.getSeatAllocations(ctx, tx, reservationId)
+	if err != nil {
+		return err
+	}
+	for _, a := range allocations {
+		if err = m.releaseFromTable(ctx, tx, reservationId, a, a.Seats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mysqlGuestRepo) releaseFromTable(ctx context.Context, tx *sql.Tx, reservationId int64,
+	allocation models.SeatAllocation, seats int64) error {
+	// Unlabelled seats are given back before the ones assigned to a guest.
+	_, err := tx.ExecContext(ctx,
+		"UPDATE seats SET reservation_id = NULL, guest_index = NULL WHERE table_id = ? AND reservation_id = ? "+
+			"ORDER BY guest_index IS NOT NULL, guest_index DESC, position DESC LIMIT ?",
+		allocation.TableId, reservationId, seats)
+	if err != nil {
+		return err
+	}
+	if err = m.syncTableCounters(ctx, tx, allocation.TableId); err != nil {
+		return err
+	}
+	if seats == allocation.Seats {
+		_, err = tx.ExecContext(ctx,
+			"DELETE FROM reservation_tables WHERE reservation_id = ? AND table_id = ?",
+			reservationId, allocation.TableId)
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE reservation_tables SET seats = seats - ? WHERE reservation_id = ? AND table_id = ?",
+		seats, reservationId, allocation.TableId)
+	return err
+}
+
+func (m *mysqlGuestRepo) getSeatAllocations(ctx context.Context, tx *sql.Tx, reservationId int64) ([]models.SeatAllocation, error) {
+	return m.querySeatAllocations(ctx, tx, reservationId, " FOR UPDATE")
+}
+
+// getSplitAllocations returns the seats a reservation holds on each table
+// when it spans more than one, as the guest list shows them. It does not lock
+// them, so that it can be used in read-only transactions.
+func (m *mysqlGuestRepo) getSplitAllocations(ctx context.Context, tx *sql.Tx, reservationId int64) ([]models.SeatAllocation, error) {
+	allocations, err := m.querySeatAllocations(ctx, tx, reservationId, "")
+	if err != nil || len(allocations) < 2 {
+		return nil, err
+	}
+	return allocations, nil
+}
+
+func (m *mysqlGuestRepo) querySeatAllocations(ctx context.Context, tx *sql.Tx, reservationId int64, lock string) ([]models.SeatAllocation, error) {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT table_id, seats FROM reservation_tables WHERE reservation_id = ? ORDER BY position"+lock,
+		reservationId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var allocations []models.SeatAllocation
+	for rows.Next() {
+		var a models.SeatAllocation
+		if err := rows.Scan(&a.TableId, &a.Seats); err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, a)
+	}
+	return allocations, rows.Err()
+}
+
+// getAllSeatAllocations maps reservation id to the seats it holds on each
+// table, for reservations spanning more than one table.
+func (m *mysqlGuestRepo) getAllSeatAllocations() (map[int64][]models.SeatAllocation, error) {
+	rows, err := m.Conn.Query(
+		"SELECT reservation_id, table_id, seats FROM reservation_tables WHERE reservation_id IN " +
+			"(SELECT reservation_id FROM reservation_tables GROUP BY reservation_id HAVING COUNT(*) > 1) " +
+			"ORDER BY reservation_id, position")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	allocations := map[int64][]models.SeatAllocation{}
+	for rows.Next() {
+		var reservationId int64
+		var a models.SeatAllocation
+		if err := rows.Scan(&reservationId, &a.TableId, &a.Seats); err != nil {
+			return nil, err
+		}
+		allocations[reservationId] = append(allocations[reservationId], a)
+	}
+	return allocations, rows.Err()
+}
+
+// syncTableCounters recomputes the aggregate counters of a table from its
+// seat assignments.
+func (m *mysqlGuestRepo) syncTableCounters(ctx context.Context, tx *sql.Tx, tableId int32) error {
+	_, err := tx.ExecContext(ctx,
+		"UPDATE tables SET booked_seats = "+
+			"(SELECT COUNT(*) FROM seats s WHERE s.table_id = tables.id AND s.reservation_id IS NOT NULL), "+
+			"available_seats = capacity - booked_seats WHERE id = ?",
+		tableId)
+	return err
+}
+
+// BackfillSeats gives the tables created before seats were modelled their
+// seats, and books the ones the reservations already have allocated there.
+// Tables that have seats are left alone, so it can run on every start. It
+// returns how many tables were backfilled.
+func (m *mysqlGuestRepo) BackfillSeats(ctx context.Context) (int, error) {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id, capacity FROM tables WHERE NOT EXISTS (SELECT 1 FROM seats s WHERE s.table_id = tables.id) FOR UPDATE")
+	if err != nil {
+		return 0, err
+	}
+	var tables []models.Table
+	for rows.Next() {
+		var t models.Table
+		if err = rows.Scan(&t.Id, &t.Capacity); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(tables) == 0 {
+		return 0, nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO seats(table_id, position) VALUES(?, ?);")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, t := range tables {
+		for position := 1; position <= t.Capacity; position++ {
+			if _, err = stmt.ExecContext(ctx, t.Id, position); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Allocations are booked in the order they were made, so a table that
+	// was overbooked before keeps the earliest reservations seated.
+	allocations, err := tx.QueryContext(ctx,
+		"SELECT rt.reservation_id, rt.table_id, rt.seats FROM reservation_tables rt "+
+			"JOIN guestsList g ON g.id = rt.reservation_id WHERE g.status IN (?, ?) ORDER BY rt.reservation_id, rt.position",
+		models.Upcoming, models.Attended)
+	if err != nil {
+		return 0, err
+	}
+	backfilled := map[int32]bool{}
+	for _, t := range tables {
+		backfilled[int32(t.Id)] = true
+	}
+	type allocation struct {
+		reservationId int64
+		models.SeatAllocation
+	}
+	var toBook []allocation
+	for allocations.Next() {
+		var a allocation
+		if err = allocations.Scan(&a.reservationId, &a.TableId, &a.Seats); err != nil {
+			allocations.Close()
+			return 0, err
+		}
+		if backfilled[a.TableId] {
+			toBook = append(toBook, a)
+		}
+	}
+	allocations.Close()
+	if err = allocations.Err(); err != nil {
+		return 0, err
+	}
+	for _, a := range toBook {
+		_, err = tx.ExecContext(ctx,
+			"UPDATE seats SET reservation_id = ? WHERE table_id = ? AND reservation_id IS NULL ORDER BY position LIMIT ?",
+			a.reservationId, a.TableId, a.Seats)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for _, t := range tables {
+		if err = m.syncTableCounters(ctx, tx, int32(t.Id)); err != nil {
+			return 0, err
+		}
+	}
+	if err = m.commit(tx); err != nil {
+		return 0, err
+	}
+	return len(tables), nil
+}
+
+func (m *mysqlGuestRepo) GetTableSeats(ctx context.Context, tableId int32) (*models.SeatList, error) {
+	rows, err := m.Conn.QueryContext(ctx,
+		"SELECT id, table_id, position, reservation_id, guest_index FROM seats WHERE table_id = ? ORDER BY position",
+		tableId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seats []models.Seat
+	for rows.Next() {
+		var s models.Seat
+		var nReservation sql.NullInt64
+		var nGuest sql.NullInt32
+		if err := rows.Scan(&s.Id, &s.TableId, &s.Position, &nReservation, &nGuest); err != nil {
+			return nil, err
+		}
+		s.ReservationId = nReservation.Int64
+		if nGuest.Valid {
+			guest := int(nGuest.Int32)
+			s.Guest = &guest
+		}
+		seats = append(seats, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(seats) == 0 {
+		return nil, fmt.Errorf("no such table_id=%v", tableId)
+	}
+	return &models.SeatList{Seats: seats}, nil
+}
+
+// AssignSeats puts members of a party on specific seats. A party can only
+// trade seats on tables where it already holds seats, so the number of seats
+// it occupies on each table does not change.
+func (m *mysqlGuestRepo) AssignSeats(ctx context.Context, name string, assignments []models.SeatAssignment) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reservation, err := m.getReservation(ctx, tx, name)
+	if err != nil {
+		return err
+	}
+	for _, a := range assignments {
+		if a.Guest < 0 || int64(a.Guest) >= reservation.AccompanyingGuests {
+			return fmt.Errorf("guest %v is not part of the reservation for %s", a.Guest, name)
+		}
+		if err = m.assignSeat(ctx, tx, reservation.Id, a); err != nil {
+			return err
+		}
+	}
+	state, err := m.reservationState(ctx, tx, reservation.Id)
+	if err != nil {
+		return err
+	}
+	entry := models.AuditEntry{Action: models.AuditSeatsAssigned, ReservationId: reservation.Id,
+		TableIds: stateTables(state)}
+	if err = m.record(ctx, tx, entry, nil, models.SeatAssignmentList{Assignments: assignments}); err != nil {
+		return err
+	}
+	if err = m.commit(tx); err != nil {
+		return err
+	}
+	log.Printf("seats of reservation id=%v were assigned", reservation.Id)
+	return nil
+}
+
+func (m *mysqlGuestRepo) assignSeat(ctx context.Context, tx *sql.Tx, reservationId int64, a models.SeatAssignment) error {
+	var targetId int64
+	var targetReservation sql.NullInt64
+	var targetGuest sql.NullInt32
+	err := tx.QueryRowContext(ctx,
+		"SELECT id, reservation_id, guest_index FROM seats WHERE table_id = ? AND position = ? FOR UPDATE",
+		a.TableId, a.Position).Scan(&targetId, &targetReservation, &targetGuest)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no seat %v at table_id=%v", a.Position, a.TableId)
+		}
+		return err
+	}
+	if targetReservation.Valid && targetReservation.Int64 != reservationId {
+		return fmt.Errorf("seat %v at table_id=%v is taken", a.Position, a.TableId)
+	}
+
+	var prevId int64
+	var prevTable int32
+	err = tx.QueryRowContext(ctx,
+		"SELECT id, table_id FROM seats WHERE reservation_id = ? AND guest_index = ? FOR UPDATE",
+		reservationId, a.Guest).Scan(&prevId, &prevTable)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if prevId == targetId {
+		return nil
+	}
+
+	if targetReservation.Valid {
+		// Both seats belong to the party, the two guests swap places.
+		if prevId != 0 {
+			_, err = tx.ExecContext(ctx, "UPDATE seats SET guest_index = ? WHERE id = ?", targetGuest, prevId)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE seats SET guest_index = ? WHERE id = ?", a.Guest, targetId)
+		return err
+	}
+
+	// The target seat is free: the party gives up one of its seats on the
+	// same table in exchange, preferably the one the guest is leaving.
+	giveUpId := prevId
+	if prevId == 0 || prevTable != a.TableId {
+		err = tx.QueryRowContext(ctx,
+			"SELECT id FROM seats WHERE reservation_id = ? AND table_id = ? AND guest_index IS NULL "+
+				"ORDER BY position LIMIT 1 FOR UPDATE",
+			reservationId, a.TableId).Scan(&giveUpId)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("the party has no seat to give up at table_id=%v", a.TableId)
+		}
+		if err != nil {
+			return err
+		}
+		if prevId != 0 {
+			if _, err = tx.ExecContext(ctx, "UPDATE seats SET guest_index = NULL WHERE id = ?", prevId); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE seats SET reservation_id = NULL, guest_index = NULL WHERE id = ?", giveUpId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE seats SET reservation_id = ?, guest_index = ? WHERE id = ?",
+		reservationId, a.Guest, targetId)
+	return err
+}
@@ -0,0 +1,365 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"log"
+	"strings"
+)
+
+// GetSnapshot reads the whole seating plan in one consistent read: tables
+// with their seats, table groups, and every reservation with its seat
+// allocations and party members.
+func (m *mysqlGuestRepo) GetSnapshot(ctx context.Context) (*models.Snapshot, error) {
+	tx, err := m.Conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	s := &models.Snapshot{Tables: []models.SnapshotTable{}, TableGroups: []models.TableGroup{},
+		Reservations: []models.SnapshotReservation{}}
+	if err = m.snapshotTables(ctx, tx, s); err != nil {
+		return nil, err
+	}
+	if err = m.snapshotTableGroups(ctx, tx, s); err != nil {
+		return nil, err
+	}
+	if err = m.snapshotReservations(ctx, tx, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m *mysqlGuestRepo) snapshotTables(ctx context.Context, tx *sql.Tx, s *models.Snapshot) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, capacity, booked_seats, available_seats FROM tables ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	index := map[int64]int{}
+	for rows.Next() {
+		t := models.SnapshotTable{Seats: []models.SnapshotSeat{}}
+		if err := rows.Scan(&t.Id, &t.Capacity, &t.BookedSeats, &t.AvailableSeats); err != nil {
+			return err
+		}
+		index[t.Id] = len(s.Tables)
+		s.Tables = append(s.Tables, t)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	seats, err := tx.QueryContext(ctx,
+		"SELECT table_id, position, reservation_id, guest_index FROM seats ORDER BY table_id, position")
+	if err != nil {
+		return err
+	}
+	defer seats.Close()
+	for seats.Next() {
+		var tableId int64
+		var seat models.SnapshotSeat
+		var nReservation, nGuest sql.NullInt64
+		if err := seats.Scan(&tableId, &seat.Position, &nReservation, &nGuest); err != nil {
+			return err
+		}
+		seat.ReservationId = nReservation.Int64
+		if nGuest.Valid {
+			guest := int(nGuest.Int64)
+			seat.Guest = &guest
+		}
+		if i, ok := index[tableId]; ok {
+			s.Tables[i].Seats = append(s.Tables[i].Seats, seat)
+		}
+	}
+	return seats.Err()
+}
+
+func (m *mysqlGuestRepo) snapshotTableGroups(ctx context.Context, tx *sql.Tx, s *models.Snapshot) error {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT tg.id, tg.name, m.table_id FROM table_groups tg "+
+			"LEFT JOIN table_group_members m ON m.group_id = tg.id ORDER BY tg.id, m.position")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name string
+		var tableId sql.NullInt32
+		if err := rows.Scan(&id, &name, &tableId); err != nil {
+			return err
+		}
+		if n := len(s.TableGroups); n == 0 || s.TableGroups[n-1].Id != id {
+			s.TableGroups = append(s.TableGroups, models.TableGroup{Id: id, Name: name, TableIds: []int32{}})
+		}
+		if tableId.Valid {
+			g := &s.TableGroups[len(s.TableGroups)-1]
+			g.TableIds = append(g.TableIds, tableId.Int32)
+		}
+	}
+	return rows.Err()
+}
+
+func (m *mysqlGuestRepo) snapshotReservations(ctx context.Context, tx *sql.Tx, s *models.Snapshot) error {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id, name, table_id, table_group_id, accompanying_guests, status, arrival_time, rsvp_token, "+
+			"invited, confirmation_code, checkin_used_at, dietary_needs, email, diet, gluten_free, nut_allergy "+
+			"FROM guestsList ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	index := map[int64]int{}
+	for rows.Next() {
+		r := models.SnapshotReservation{Tables: []models.SeatAllocation{}, Members: []models.PartyMember{}}
+		var nTable sql.NullInt32
+		var nGroup, nGuests, nArrival, nUsed sql.NullInt64
+		var nToken, nCode sql.NullString
+		if err := rows.Scan(&r.Id, &r.Name, &nTable, &nGroup, &nGuests, &r.Status, &nArrival, &nToken, &r.Invited, &nCode,
+			&nUsed, &r.DietaryNeeds, &r.Email, &r.Diet, &r.GlutenFree, &r.NutAllergy); err != nil {
+			return err
+		}
+		r.TableId = nTable.Int32
+		r.TableGroupId = nGroup.Int64
+		r.AccompanyingGuests = nGuests.Int64
+		r.ArrivalTime = nArrival.Int64
+		r.Token = nToken.String
+		r.ConfirmationCode = nCode.String
+		r.CheckInUsedAt = nUsed.Int64
+		index[r.Id] = len(s.Reservations)
+		s.Reservations = append(s.Reservations, r)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	allocations, err := tx.QueryContext(ctx,
+		"SELECT reservation_id, table_id, seats FROM reservation_tables ORDER BY reservation_id, position")
+	if err != nil {
+		return err
+	}
+	defer allocations.Close()
+	for allocations.Next() {
+		var reservationId int64
+		var a models.SeatAllocation
+		if err := allocations.Scan(&reservationId, &a.TableId, &a.Seats); err != nil {
+			return err
+		}
+		if i, ok := index[reservationId]; ok {
+			s.Reservations[i].Tables = append(s.Reservations[i].Tables, a)
+		}
+	}
+	if err = allocations.Err(); err != nil {
+		return err
+	}
+
+	members, err := tx.QueryContext(ctx,
+		"SELECT id, reservation_id, name, dietary_needs, age_group, accessibility, diet, gluten_free, nut_allergy "+
+			"FROM party_members ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer members.Close()
+	for members.Next() {
+		var p models.PartyMember
+		if err := members.Scan(&p.Id, &p.ReservationId, &p.Name, &p.DietaryNeeds, &p.AgeGroup, &p.Accessibility,
+			&p.Diet, &p.GlutenFree, &p.NutAllergy); err != nil {
+			return err
+		}
+		if i, ok := index[p.ReservationId]; ok {
+			s.Reservations[i].Members = append(s.Reservations[i].Members, p)
+		}
+	}
+	return members.Err()
+}
+
+// RestoreSnapshot loads a validated snapshot in one transaction. In replace
+// mode the current state is deleted first and all ids are kept. In merge mode
+// the snapshot is added next to the current state under new ids; it is
+// refused when a name, token or confirmation code is already taken.
+func (m *mysqlGuestRepo) RestoreSnapshot(ctx context.Context, s *models.Snapshot, merge bool) (*models.SnapshotReport, error) {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	report := &models.SnapshotReport{Mode: "replace", Tables: len(s.Tables), Reservations: len(s.Reservations)}
+	if merge {
+		report.Mode = "merge"
+		if report.Errors, err = m.snapshotConflicts(ctx, tx, s); err != nil || len(report.Errors) > 0 {
+			return report, err
+		}
+	} else {
+		for _, table := range []string{"party_members", "seats", "reservation_tables", "guestsList",
+			"table_group_members", "table_groups", "tables"} {
+			if _, err = tx.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Ids from the snapshot are kept when replacing; when merging, insertRow is
+	// given 0 and the database picks new ones.
+	keep := func(id int64) int64 {
+		if merge {
+			return 0
+		}
+		return id
+	}
+
+	tableIds := map[int64]int64{}
+	for _, t := range s.Tables {
+		id, err := insertRow(ctx, tx, "tables", keep(t.Id), []string{"capacity", "booked_seats", "available_seats"},
+			t.Capacity, t.BookedSeats, t.AvailableSeats)
+		if err != nil {
+			return nil, err
+		}
+		tableIds[t.Id] = id
+	}
+	groupIds := map[int64]int64{}
+	for _, g := range s.TableGroups {
+		id, err := insertRow(ctx, tx, "table_groups", keep(g.Id), []string{"name"}, g.Name)
+		if err != nil {
+			return nil, err
+		}
+		groupIds[g.Id] = id
+		for position, tableId := range g.TableIds {
+			_, err = tx.ExecContext(ctx,
+				"INSERT INTO table_group_members(group_id, table_id, position) VALUES (?, ?, ?);",
+				id, tableIds[int64(tableId)], position)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	reservationIds := map[int64]int64{}
+	for _, r := range s.Reservations {
+		id, err := insertRow(ctx, tx, "guestsList", keep(r.Id),
+			[]string{"name", "table_id", "table_group_id", "accompanying_guests", "status", "arrival_time", "rsvp_token",
+				"invited", "confirmation_code", "checkin_used_at", "dietary_needs", "email", "diet", "gluten_free",
+				"nut_allergy"},
+			r.Name, sql.NullInt64{Int64: tableIds[int64(r.TableId)], Valid: r.TableId != 0},
+			nullGroupId(groupIds[r.TableGroupId]), r.AccompanyingGuests, r.Status,
+			sql.NullInt64{Int64: r.ArrivalTime, Valid: r.ArrivalTime != 0},
+			sql.NullString{String: r.Token, Valid: r.Token != ""}, r.Invited,
+			sql.NullString{String: r.ConfirmationCode, Valid: r.ConfirmationCode != ""},
+			sql.NullInt64{Int64: r.CheckInUsedAt, Valid: r.CheckInUsedAt != 0},
+			r.DietaryNeeds, r.Email, r.Diet, r.GlutenFree, r.NutAllergy)
+		if err != nil {
+			return nil, err
+		}
+		reservationIds[r.Id] = id
+		for position, a := range r.Tables {
+			_, err = tx.ExecContext(ctx,
+				"INSERT INTO reservation_tables(reservation_id, table_id, seats, position) VALUES (?, ?, ?, ?)",
+				id, tableIds[int64(a.TableId)], a.Seats, position)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, p := range r.Members {
+			_, err = insertRow(ctx, tx, "party_members", keep(p.Id),
+				[]string{"reservation_id", "name", "dietary_needs", "age_group", "accessibility", "diet", "gluten_free",
+					"nut_allergy"},
+				id, p.Name, p.DietaryNeeds, p.AgeGroup, p.Accessibility, p.Diet, p.GlutenFree, p.NutAllergy)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, t := range s.Tables {
+		for _, seat := range t.Seats {
+			var guest sql.NullInt64
+			if seat.Guest != nil {
+				guest = sql.NullInt64{Int64: int64(*seat.Guest), Valid: true}
+			}
+			_, err = tx.ExecContext(ctx,
+				"INSERT INTO seats(table_id, position, reservation_id, guest_index) VALUES (?, ?, ?, ?)",
+				tableIds[t.Id], seat.Position,
+				sql.NullInt64{Int64: reservationIds[seat.ReservationId], Valid: seat.ReservationId != 0}, guest)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = m.auditRestore(ctx, tx, s, report, tableIds, reservationIds); err != nil {
+		return nil, err
+	}
+	if err = m.commit(tx); err != nil {
+		return nil, err
+	}
+	log.Printf("snapshot restored (%s): %v tables, %v reservations", report.Mode, report.Tables, report.Reservations)
+	return report, nil
+}
+
+// auditRestore records a restore, then the state every restored table and
+// reservation starts from, under the ids they were given.
+func (m *mysqlGuestRepo) auditRestore(ctx context.Context, tx *sql.Tx, s *models.Snapshot, report *models.SnapshotReport,
+	tableIds, reservationIds map[int64]int64) error {
+	if err := m.record(ctx, tx, models.AuditEntry{Action: models.AuditSnapshotRestored}, nil, report); err != nil {
+		return err
+	}
+	for _, t := range s.Tables {
+		table := t.Table
+		table.Id = tableIds[t.Id]
+		entry := models.AuditEntry{Action: models.AuditTableRestored, TableIds: []int64{table.Id}}
+		if err := m.record(ctx, tx, entry, nil, table); err != nil {
+			return err
+		}
+	}
+	for _, r := range s.Reservations {
+		if err := m.auditReservation(ctx, tx, models.AuditRestored, reservationIds[r.Id], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotConflicts lists what stops a snapshot from being merged into the
+// current state.
+func (m *mysqlGuestRepo) snapshotConflicts(ctx context.Context, tx *sql.Tx, s *models.Snapshot) ([]string, error) {
+	var conflicts []string
+	for _, r := range s.Reservations {
+		var id int64
+		err := tx.QueryRowContext(ctx,
+			"SELECT id FROM guestsList WHERE (name = ? AND status IN (?, ?, ?)) OR rsvp_token = ? OR confirmation_code = ? "+
+				"LIMIT 1",
+			r.Name, models.Upcoming, models.Attended, models.Invited, r.Token, r.ConfirmationCode).Scan(&id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, fmt.Sprintf(
+			"reservation %d: %s, its token or its confirmation code is already in use", r.Id, r.Name))
+	}
+	return conflicts, nil
+}
+
+// insertRow inserts one row and returns its id. id is written as well unless
+// it is 0, in which case the database assigns one. table and columns are
+// never user input.
+func insertRow(ctx context.Context, tx *sql.Tx, table string, id int64, columns []string,
+	values ...interface{}) (int64, error) {
+	if id != 0 {
+		columns = append([]string{"id"}, columns...)
+		values = append([]interface{}{id}, values...)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO "+table+"("+strings.Join(columns, ", ")+") VALUES ("+placeholders+")", values...)
+	if err != nil {
+		return 0, err
+	}
+	if id != 0 {
+		return id, nil
+	}
+	return res.LastInsertId()
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"log"
+)
+
+type syncChange struct {
+	row         *models.ImportRow
+	reservation *models.GuestsReservation
+}
+
+// SyncGuestList makes the guest list match a desired list: parties missing
+// from it are cancelled, parties whose table or size differ are re-seated and
+// new names are booked. Everything happens in one transaction with the usual
+// capacity checks; a dry run, or any error, rolls it back so the result is an
+// exact preview. Parties that have already arrived are never removed or
+// changed.
+func (m *mysqlGuestRepo) SyncGuestList(ctx context.Context, rows []models.ImportRow, dryRun bool) (*models.SyncResult, error) {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := m.getSyncedReservations(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*models.GuestsReservation{}
+	for i := range current {
+		byName[current[i].Name] = &current[i]
+	}
+
+	result := &models.SyncResult{DryRun: dryRun, Added: []models.SyncParty{}, Removed: []models.SyncParty{},
+		Changed: []models.SyncChange{}}
+	rowError := func(row *models.ImportRow, message string) {
+		result.Errors = append(result.Errors, models.RowError{Row: row.Row, Name: row.Name, Message: message})
+	}
+	var added []*models.ImportRow
+	var changed []syncChange
+	wanted := map[string]bool{}
+	for i := range rows {
+		row := &rows[i]
+		wanted[row.Name] = true
+		reservation, ok := byName[row.Name]
+		switch {
+		case !ok:
+			added = append(added, row)
+		case reservation.Status == models.Invited:
+			rowError(row, row.Name+" has an open invitation")
+		case sameSeating(reservation, &row.GuestsReservation):
+			result.Unchanged++
+		case reservation.Status == models.Attended:
+			rowError(row, row.Name+" has already arrived")
+		default:
+			changed = append(changed, syncChange{row: row, reservation: reservation})
+		}
+	}
+
+	for i := range current {
+		reservation := &current[i]
+		if wanted[reservation.Name] || reservation.Status != models.Upcoming {
+			continue
+		}
+		if err = m.cancel(ctx, tx, reservation); err != nil {
+			return nil, err
+		}
+		result.Removed = append(result.Removed, syncParty(reservation))
+	}
+
+	// All changed parties give their seats back first, so that two parties
+	// can swap tables.
+	states := map[int64]*models.ReservationState{}
+	for _, c := range changed {
+		if states[c.reservation.Id], err = m.reservationState(ctx, tx, c.reservation.Id); err != nil {
+			return nil, err
+		}
+		if err = m.releaseAllSeats(ctx, tx, c.reservation.Id); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range changed {
+		before := syncParty(c.reservation)
+		if err = m.reseat(ctx, tx, c.reservation, &c.row.GuestsReservation); err != nil {
+			rowError(c.row, err.Error())
+			continue
+		}
+		err = m.auditReservation(ctx, tx, models.AuditSynced, c.reservation.Id, states[c.reservation.Id])
+		if err != nil {
+			return nil, err
+		}
+		before.Name = ""
+		after := syncParty(&c.row.GuestsReservation)
+		after.Name = ""
+		result.Changed = append(result.Changed, models.SyncChange{Name: c.row.Name, Before: before, After: after})
+	}
+
+	for _, row := range added {
+		if err = m.createReservation(ctx, tx, &row.GuestsReservation); err != nil {
+			rowError(row, err.Error())
+			continue
+		}
+		result.Added = append(result.Added, syncParty(&row.GuestsReservation))
+	}
+
+	if dryRun || len(result.Errors) > 0 {
+		return result, nil
+	}
+	if err = m.commit(tx); err != nil {
+		return nil, err
+	}
+	log.Printf("guest list synced: %v added, %v removed, %v changed",
+		len(result.Added), len(result.Removed), len(result.Changed))
+	return result, nil
+}
+
+// getSyncedReservations loads, in name order, the reservations a sync compares
+// against, locking them for the rest of the transaction.
+func (m *mysqlGuestRepo) getSyncedReservations(ctx context.Context, tx *sql.Tx) ([]models.GuestsReservation, error) {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id, name, table_id, table_group_id, accompanying_guests, status FROM guestsList "+
+			"WHERE status IN (?, ?, ?) ORDER BY name FOR UPDATE",
+		models.Upcoming, models.Attended, models.Invited)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reservations []models.GuestsReservation
+	for rows.Next() {
+		var r models.GuestsReservation
+		var nTable sql.NullInt32
+		var nGroup, nGuests sql.NullInt64
+		if err := rows.Scan(&r.Id, &r.Name, &nTable, &nGroup, &nGuests, &r.Status); err != nil {
+			return nil, err
+		}
+		r.TableId = nTable.Int32
+		r.TableGroupId = nGroup.Int64
+		r.AccompanyingGuests = nGuests.Int64
+		reservations = append(reservations, r)
+	}
+	return reservations, rows.Err()
+}
+
+// reseat books the seats of a reservation that holds none at the table and
+// party size of guest.
+func (m *mysqlGuestRepo) reseat(ctx context.Context, tx *sql.Tx, reservation *models.GuestsReservation,
+	guest *models.GuestsReservation) error {
+	if err := m.checkRoster(ctx, tx, reservation, guest.AccompanyingGuests); err != nil {
+		return err
+	}
+	tableIds, err := m.candidateTables(ctx, tx, guest.TableId, guest.TableGroupId)
+	if err != nil {
+		return err
+	}
+	if err = m.allocateSeats(ctx, tx, reservation.Id, tableIds, guest.AccompanyingGuests); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE guestsList SET table_id = ?, table_group_id = ?, accompanying_guests = ? where id = ?",
+		tableIds[0], nullGroupId(guest.TableGroupId), guest.AccompanyingGuests, reservation.Id)
+	if err != nil {
+		return err
+	}
+	guest.Id = reservation.Id
+	guest.TableId = tableIds[0]
+	return nil
+}
+
+// sameSeating reports whether guest asks for the table and party size the
+// reservation already has. A party booked on a table group only matches the
+// same group.
+func sameSeating(reservation *models.GuestsReservation, guest *models.GuestsReservation) bool {
+	if reservation.AccompanyingGuests != guest.AccompanyingGuests {
+		return false
+	}
+	if guest.TableGroupId != 0 {
+		return reservation.TableGroupId == guest.TableGroupId
+	}
+	return reservation.TableGroupId == 0 && reservation.TableId == guest.TableId
+}
+
+func syncParty(r *models.GuestsReservation) models.SyncParty {
+	return models.SyncParty{Name: r.Name, TableId: r.TableId, TableGroupId: r.TableGroupId,
+		AccompanyingGuests: r.AccompanyingGuests}
+}
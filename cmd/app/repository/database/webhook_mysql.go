@@ -0,0 +1,269 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository"
+	"log"
+	"strings"
+	"time"
+)
+
+// CreateWebhook adds a webhook; without a secret a random one is made up.
+func (m *mysqlGuestRepo) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	if webhook.Secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		webhook.Secret = hex.EncodeToString(b)
+	}
+	res, err := m.Conn.ExecContext(ctx,
+		"INSERT INTO webhooks(url, event_type, secret, active) VALUES (?, ?, ?, TRUE)",
+		webhook.URL, webhook.EventType, webhook.Secret)
+	if err != nil {
+		return err
+	}
+	if webhook.Id, err = res.LastInsertId(); err != nil {
+		return err
+	}
+	log.Printf("New webhook id=%v for %s was added", webhook.Id, webhook.EventType)
+	return nil
+}
+
+// GetWebhooks lists the active webhooks, without their secrets.
+func (m *mysqlGuestRepo) GetWebhooks(ctx context.Context) (*models.WebhookList, error) {
+	rows, err := m.Conn.QueryContext(ctx, "SELECT id, url, event_type FROM webhooks WHERE active ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var w models.Webhook
+		if err := rows.Scan(&w.Id, &w.URL, &w.EventType); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return &models.WebhookList{Webhooks: webhooks}, nil
+}
+
+// DeleteWebhook stops a webhook. Its messages that were not delivered yet are
+// dropped; the delivery log is kept.
+func (m *mysqlGuestRepo) DeleteWebhook(ctx context.Context, id int64) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = m.webhookExists(ctx, tx, id); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE webhooks SET active = FALSE WHERE id = ?", id); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE webhook_outbox SET next_attempt_at = NULL WHERE webhook_id = ? AND delivered_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("webhook id=%v was deleted", id)
+	return nil
+}
+
+func (m *mysqlGuestRepo) webhookExists(ctx context.Context, tx *sql.Tx, id int64) error {
+	var found int64
+	err := tx.QueryRowContext(ctx, "SELECT id FROM webhooks WHERE id = ? AND active FOR UPDATE", id).Scan(&found)
+	if err == sql.ErrNoRows {
+		return repository.ErrNoSuchWebhook
+	}
+	return err
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, oldest first.
+func (m *mysqlGuestRepo) GetWebhookDeliveries(ctx context.Context, webhookId int64) (*models.WebhookDeliveryList, error) {
+	var found int64
+	err := m.Conn.QueryRowContext(ctx, "SELECT id FROM webhooks WHERE id = ?", webhookId).Scan(&found)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNoSuchWebhook
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.Conn.QueryContext(ctx,
+		"SELECT d.id, d.message_id, o.event_type, d.attempt, d.attempted_at, d.status_code, d.error, d.duration_ms, "+
+			"d.delivered FROM webhook_deliveries d JOIN webhook_outbox o ON o.id = d.message_id "+
+			"WHERE o.webhook_id = ? ORDER BY d.id", webhookId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.Id, &d.MessageId, &d.EventType, &d.Attempt, &d.AttemptedAt, &d.StatusCode, &d.Error,
+			&d.DurationMs, &d.Delivered); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return &models.WebhookDeliveryList{Deliveries: deliveries}, nil
+}
+
+func isWebhookEvent(action string) bool {
+	for _, e := range models.WebhookEvents {
+		if e == action {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueueWebhooks puts a change of a reservation in the outbox of every
+// webhook subscribed to it, in the transaction of the change, so that a
+// message is sent if and only if the change is kept.
+func (m *mysqlGuestRepo) enqueueWebhooks(ctx context.Context, tx *sql.Tx, action string,
+	state *models.ReservationState) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM webhooks WHERE event_type = ? AND active", action)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var webhookIds []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		webhookIds = append(webhookIds, id)
+	}
+	if err = rows.Err(); err != nil || len(webhookIds) == 0 {
+		return err
+	}
+
+	now := time.Now().UTC()
+	payload, err := json.Marshal(models.WebhookPayload{EventType: action, OccurredAt: now.Truncate(time.Second),
+		Reservation: *state})
+	if err != nil {
+		return err
+	}
+	for _, id := range webhookIds {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO webhook_outbox(webhook_id, event_type, payload, created_at, attempts, next_attempt_at) "+
+				"VALUES (?, ?, ?, ?, 0, ?)",
+			id, action, string(payload), now.Unix(), now.Unix())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClaimWebhookMessages returns up to limit messages due for delivery and
+// holds them back from other claims for lease, so that a message is not sent
+// twice at once.
+func (m *mysqlGuestRepo) ClaimWebhookMessages(ctx context.Context, now time.Time, lease time.Duration,
+	limit int) ([]models.WebhookMessage, error) {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT o.id, o.webhook_id, w.url, w.secret, o.event_type, o.payload, o.attempts FROM webhook_outbox o "+
+			"JOIN webhooks w ON w.id = o.webhook_id "+
+			"WHERE o.next_attempt_at <= ? AND w.active ORDER BY o.id LIMIT ? FOR UPDATE",
+		now.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.WebhookMessage
+	for rows.Next() {
+		var msg models.WebhookMessage
+		var payload string
+		if err := rows.Scan(&msg.Id, &msg.WebhookId, &msg.URL, &msg.Secret, &msg.EventType, &payload,
+			&msg.Attempts); err != nil {
+			return nil, err
+		}
+		msg.Payload = []byte(payload)
+		messages = append(messages, msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]interface{}, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.Id
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE webhook_outbox SET next_attempt_at = ? WHERE id IN (?"+strings.Repeat(", ?", len(ids)-1)+")",
+		append([]interface{}{now.Add(lease).Unix()}, ids...)...)
+	if err != nil {
+		return nil, err
+	}
+	return messages, tx.Commit()
+}
+
+// RecordWebhookDelivery writes one attempt to the delivery log. An undelivered
+// message is tried again at retryAt, or given up when retryAt is zero.
+func (m *mysqlGuestRepo) RecordWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery,
+	attemptedAt, retryAt time.Time) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO webhook_deliveries(message_id, attempt, attempted_at, status_code, error, duration_ms, delivered) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?)",
+		delivery.MessageId, delivery.Attempt, attemptedAt.Unix(), delivery.StatusCode, delivery.Error,
+		delivery.DurationMs, delivery.Delivered)
+	if err != nil {
+		return err
+	}
+	switch {
+	case delivery.Delivered:
+		_, err = tx.ExecContext(ctx,
+			"UPDATE webhook_outbox SET attempts = ?, next_attempt_at = NULL, delivered_at = ? WHERE id = ?",
+			delivery.Attempt, attemptedAt.Unix(), delivery.MessageId)
+	case retryAt.IsZero():
+		_, err = tx.ExecContext(ctx,
+			"UPDATE webhook_outbox SET attempts = ?, next_attempt_at = NULL WHERE id = ?",
+			delivery.Attempt, delivery.MessageId)
+	default:
+		_, err = tx.ExecContext(ctx,
+			"UPDATE webhook_outbox SET attempts = ?, next_attempt_at = ? WHERE id = ?",
+			delivery.Attempt, retryAt.Unix(), delivery.MessageId)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
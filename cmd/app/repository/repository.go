@@ -2,9 +2,39 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"time"
 )
 
+var ErrNotEnoughSeats = errors.New("not enough seats")
+var ErrNoSuchMember = errors.New("no such party member")
+var ErrNoSuchInvitation = errors.New("no such invitation")
+var ErrInvitationClosed = errors.New("the invitation can no longer be changed")
+var ErrUnknownToken = errors.New("no reservation for this token")
+var ErrUnknownCode = errors.New("no reservation with this confirmation code")
+var ErrAlreadyCheckedIn = errors.New("the check-in token was already used")
+var ErrReservationClosed = errors.New("the reservation can no longer be changed")
+var ErrNoSuchWebhook = errors.New("no such webhook")
+var ErrRosterTooLarge = errors.New("the party is too small for its named guests")
+var ErrNoTableChosen = errors.New("no table was chosen")
+
+type actorKey struct{}
+
+// WithActor returns a context telling the audit log who makes the changes
+// done with it.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor is who makes the changes done with ctx, "system" when nobody said.
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return "system"
+}
+
 type GuestRepo interface {
 	CreateTableId(ctx context.Context, table models.Table) (int64, error)
 	CreateGuestReservationID (ctx context.Context, guest *models.GuestsReservation) error
@@ -13,4 +43,51 @@ type GuestRepo interface {
 	GetArrivedGuests() (*models.GuestList, error)
 	GetEmptySeats() (*models.Seats, error)
 	GuestLeaves(ctx context.Context, name string) error
+	CreateTableGroup(ctx context.Context, group *models.TableGroup) error
+	GetTableGroups() (*models.TableGroupList, error)
+	MoveReservation(ctx context.Context, guest *models.GuestsReservation) error
+	GetTableSeats(ctx context.Context, tableId int32) (*models.SeatList, error)
+	AssignSeats(ctx context.Context, name string, assignments []models.SeatAssignment) error
+	BackfillSeats(ctx context.Context) (int, error)
+	Migrate(ctx context.Context) error
+	GetPartyMembers(ctx context.Context, name string) (*models.PartyMemberList, error)
+	AddPartyMember(ctx context.Context, name string, member *models.PartyMember) error
+	UpdatePartyMember(ctx context.Context, name string, member *models.PartyMember) error
+	RemovePartyMember(ctx context.Context, name string, memberId int64) error
+	GetCateringReport(ctx context.Context) (*models.CateringReport, error)
+	CreateInvitation(ctx context.Context, guest *models.GuestsReservation) error
+	GetInvitations(ctx context.Context) (*models.GuestList, error)
+	GetInvitation(ctx context.Context, token string) (*models.GuestsReservation, error)
+	AcceptInvitation(ctx context.Context, token string, guest *models.GuestsReservation) error
+	DeclineInvitation(ctx context.Context, token string) error
+	ChangeInvitation(ctx context.Context, token string, accompanyingGuests int64) error
+	GetReservationByToken(ctx context.Context, token string) (*models.PortalReservation, error)
+	ChangePartySize(ctx context.Context, token string, accompanyingGuests int64) error
+	UpdateDietaryRequirements(ctx context.Context, token string, reservation *models.PortalReservation) error
+	CancelReservation(ctx context.Context, token string) error
+	GetReservationByCode(ctx context.Context, code string) (*models.GuestsReservation, error)
+	CheckInByCode(ctx context.Context, code string, guest *models.GuestsReservation) error
+	CancelByCode(ctx context.Context, code string) error
+	CheckInById(ctx context.Context, reservationId int64, guest *models.GuestsReservation) error
+	GetReservationsForLookup(ctx context.Context) ([]models.GuestsReservation, error)
+	ImportReservations(ctx context.Context, rows []models.ImportRow) ([]models.RowError, error)
+	StreamGuests(ctx context.Context, arrivedOnly bool, fn func(models.GuestsReservation) error) error
+	SyncGuestList(ctx context.Context, rows []models.ImportRow, dryRun bool) (*models.SyncResult, error)
+	GetSnapshot(ctx context.Context) (*models.Snapshot, error)
+	RestoreSnapshot(ctx context.Context, s *models.Snapshot, merge bool) (*models.SnapshotReport, error)
+	CheckSeats(ctx context.Context) (*models.SeatCheckReport, error)
+	RepairSeats(ctx context.Context) (*models.SeatCheckReport, error)
+	GetAuditLog(ctx context.Context, filter models.AuditFilter) (*models.AuditLog, error)
+	LatestAuditId(ctx context.Context) (int64, error)
+	OnCommit(fn func())
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	GetWebhooks(ctx context.Context) (*models.WebhookList, error)
+	DeleteWebhook(ctx context.Context, id int64) error
+	GetWebhookDeliveries(ctx context.Context, webhookId int64) (*models.WebhookDeliveryList, error)
+	ClaimWebhookMessages(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookMessage, error)
+	RecordWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery, attemptedAt, retryAt time.Time) error
+	GetNotifications(ctx context.Context, reservationId int64) (*models.NotificationList, error)
+	QueueReminders(ctx context.Context) (int, error)
+	ClaimNotifications(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.Notification, error)
+	RecordNotificationAttempt(ctx context.Context, id int64, attempt int, sendErr error, attemptedAt, retryAt time.Time) error
 }
@@ -0,0 +1,186 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// MinScore is the lowest score a name needs to be offered as a match.
+const MinScore = 0.6
+
+var foldings = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l", 'ĺ': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ŕ': "r", 'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ţ': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// Normalise lower-cases a name, strips diacritics and punctuation and
+// collapses runs of whitespace, so that "Tóm  Smith" and "tom smith" compare
+// equal.
+func Normalise(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case foldings[r] != "":
+			b.WriteString(foldings[r])
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || r == '-':
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Score rates how well name matches what was typed at the desk, from 0 for
+// nothing in common to 1 for the same name.
+func Score(query, name string) float64 {
+	q, n := Normalise(query), Normalise(name)
+	if q == "" || n == "" {
+		return 0
+	}
+	if q == n {
+		return 1
+	}
+	qFields, nFields := strings.Fields(q), strings.Fields(n)
+	if sameFields(qFields, nFields) {
+		// Surname first, or any other order of the same names.
+		return 0.95
+	}
+	if prefixes(qFields, nFields) {
+		return 0.9 - 0.1*float64(len(n)-len(q))/float64(len(n))
+	}
+
+	best := similarity(q, n)
+	if len(qFields) > 1 {
+		if s := similarity(strings.Join(reversed(qFields), " "), n); s > best {
+			best = s
+		}
+	}
+	// A single word typed can be a first name or a surname.
+	if len(qFields) == 1 {
+		for _, f := range nFields {
+			if s := 0.9 * similarity(q, f); s > best {
+				best = s
+			}
+		}
+	}
+	return best
+}
+
+// Match is a candidate name with its score.
+type Match struct {
+	Index int
+	Score float64
+}
+
+// Rank scores every name and returns the ones good enough to offer, best
+// first, at most limit of them. Index refers back to names.
+func Rank(query string, names []string, limit int) []Match {
+	var matches []Match
+	for i, name := range names {
+		if s := Score(query, name); s >= MinScore {
+			matches = append(matches, Match{Index: i, Score: s})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// Distance is the Levenshtein edit distance between a and b.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func similarity(a, b string) float64 {
+	longest := len([]rune(a))
+	if l := len([]rune(b)); l > longest {
+		longest = l
+	}
+	return 1 - float64(Distance(a, b))/float64(longest)
+}
+
+// prefixes reports whether every typed word starts a different word of the
+// name, in any order.
+func prefixes(query, name []string) bool {
+	if len(query) > len(name) {
+		return false
+	}
+	used := make([]bool, len(name))
+	for _, q := range query {
+		found := false
+		for i, n := range name {
+			if !used[i] && strings.HasPrefix(n, q) {
+				used[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func sameFields(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	as := append([]string(nil), a...)
+	bs := append([]string(nil), b...)
+	sort.Strings(as)
+	sort.Strings(bs)
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func reversed(fields []string) []string {
+	out := make([]string, len(fields))
+	for i, f := range fields {
+		out[len(fields)-1-i] = f
+	}
+	return out
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/auth"
+	"github.com/getground/tech-tasks/backend/cmd/app/config"
+	"github.com/getground/tech-tasks/backend/cmd/app/guestcsv"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository/database"
+	"os"
+	"strings"
+)
+
+// commandActor is who the audit log shows as making the changes of a command.
+const commandActor = "cli"
+
+// RunCommand runs one of the maintenance commands given on the command line
+// instead of the API server.
+func RunCommand(name string, args []string) error {
+	switch name {
+	case "import-guests":
+		if len(args) != 1 {
+			return errors.New("usage: app import-guests <file.csv>")
+		}
+		return importGuests(args[0])
+	case "check-seats":
+		if len(args) > 1 || len(args) == 1 && args[0] != "--repair" {
+			return errors.New("usage: app check-seats [--repair]")
+		}
+		return checkSeats(len(args) == 1)
+	case "new-api-key":
+		if len(args) != 2 || args[0] == "" || strings.ContainsAny(args[0], ":,") || !auth.Role(args[1]).Valid() {
+			return errors.New("usage: app new-api-key <name> admin|host|door|read-only")
+		}
+		return newAPIKey(args[0], auth.Role(args[1]))
+	case "print-config":
+		cfg, err := config.Load(args, os.LookupEnv)
+		if err != nil {
+			return err
+		}
+		cfg.Print(os.Stdout)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+func commandContext() context.Context {
+	return repository.WithActor(context.Background(), commandActor)
+}
+
+// connect connects to the database of the config file and the environment.
+func connect() (*sql.DB, error) {
+	cfg, err := config.Load(nil, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	return Connect(cfg.DB)
+}
+
+func importGuests(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rows, rowErrors, err := guestcsv.Parse(f)
+	if err != nil {
+		return err
+	}
+	if len(rowErrors) == 0 {
+		db, err := connect()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		rowErrors, err = database.NewSQLGuestRepo(db).ImportReservations(commandContext(), rows)
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range rowErrors {
+		fmt.Fprintf(os.Stderr, "row %d: %s\n", e.Row, e.Message)
+	}
+	if len(rowErrors) > 0 {
+		return fmt.Errorf("nothing was imported, %d errors found", len(rowErrors))
+	}
+	fmt.Printf("%d reservations imported\n", len(rows))
+	return nil
+}
+
+// checkSeats prints every seat discrepancy, and repairs them when asked to. It
+// fails while any are left, so that it can be used from scripts.
+func checkSeats(repair bool) error {
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo := database.NewSQLGuestRepo(db)
+	report, err := repo.CheckSeats(commandContext())
+	if repair {
+		report, err = repo.RepairSeats(commandContext())
+	}
+	if err != nil {
+		return err
+	}
+	for _, d := range report.Discrepancies {
+		if d.ReservationId != 0 {
+			fmt.Printf("reservation %d", d.ReservationId)
+			if d.TableId != 0 {
+				fmt.Printf(" at table %d", d.TableId)
+			}
+		} else {
+			fmt.Printf("table %d", d.TableId)
+		}
+		fmt.Printf(": %s is %d, expected %d\n", d.Field, d.Actual, d.Expected)
+	}
+	for _, e := range report.Errors {
+		fmt.Fprintln(os.Stderr, e)
+	}
+	fmt.Printf("%d tables and %d reservations checked, %d discrepancies found\n",
+		report.TablesChecked, report.ReservationsChecked, len(report.Discrepancies))
+	switch {
+	case len(report.Errors) > 0:
+		return errors.New("nothing was repaired")
+	case report.Repaired:
+		fmt.Println("all discrepancies repaired")
+	case len(report.Discrepancies) > 0:
+		return errors.New("seat counters are inconsistent, run with --repair to fix them")
+	}
+	return nil
+}
+
+// newAPIKey makes up a key for name and prints it with the API_KEYS entry
+// to add for it. Only the hash is kept, so the key cannot be shown again.
+func newAPIKey(name string, role auth.Role) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	key := base64.RawURLEncoding.EncodeToString(b)
+	fmt.Printf("key:      %s\nAPI_KEYS: %s:%s:%s\n", key, name, role, auth.HashKey(key))
+	return nil
+}
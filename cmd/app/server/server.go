@@ -1,64 +1,416 @@
 package api
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/auth"
+	"github.com/getground/tech-tasks/backend/cmd/app/config"
 	"github.com/getground/tech-tasks/backend/cmd/app/handlers"
+	"github.com/getground/tech-tasks/backend/cmd/app/health"
+	"github.com/getground/tech-tasks/backend/cmd/app/live"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/notify"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository/database"
+	"github.com/getground/tech-tasks/backend/cmd/app/webhook"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
-	_ "github.com/joho/godotenv/autoload"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 type Server struct {
 	Router   *mux.Router
 	DB       *sql.DB
 	Handlers *handlers.Post
+	// Webhooks and Live are nil when turned off.
+	Webhooks *webhook.Dispatcher
+	Live     *live.Hub
+	Auth     *auth.Middleware
+	Config   config.Config
+	// Health tells whether the database is available.
+	Health   *health.Checker
+	// Notifications is nil when turned off or no SMTP server is configured.
+	Notifications *notify.Sender
 }
 
+// webhookInterval is how often the webhook outbox is checked for messages
+// that are due.
+const webhookInterval = 5 * time.Second
+
+// notificationInterval is how often notifications that are due are sent.
+const notificationInterval = 30 * time.Second
+
+// healthInterval is how often the database is checked while it is available.
+const healthInterval = 5 * time.Second
+
+// Timeouts of the HTTP server. Live streams end a little before the write
+// timeout and are picked up again by their clients.
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 60 * time.Second
+	idleTimeout       = 2 * time.Minute
+	streamLimit       = writeTimeout - 5*time.Second
+	// shutdownTimeout is how long requests in flight are given to finish.
+	shutdownTimeout = 20 * time.Second
+)
+
 func NewSerwer() *Server {
 	return &Server{}
 }
 
 
+// Connect opens the connection pool to the database and waits for the
+// database to answer, retrying as cfg says.
+func Connect(cfg config.DB) (*sql.DB, error) {
+	db, err := sql.Open("mysql", cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	if err = health.Wait(context.Background(), db, retry(cfg)); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func retry(cfg config.DB) health.Retry {
+	return health.Retry{Initial: cfg.RetryInitial, Max: cfg.RetryMax, Timeout: cfg.WaitTimeout}
+}
+
+// Init sets the server up with the database given and the rest of the
+// configuration from the environment.
 func (s *Server) Init(user, password, host, port, name string) {
-	var err error
-	source := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", user, password, host, port, name)
-	s.DB, err = sql.Open("mysql", source)
+	given := map[string]string{"DB_USER": user, "DB_PASSWORD": password, "DB_HOST": host, "DB_PORT": port,
+		"DB_NAME": name}
+	cfg, err := config.Load(nil, func(key string) (string, bool) {
+		if v, ok := given[key]; ok {
+			return v, true
+		}
+		return os.LookupEnv(key)
+	})
 	if err != nil {
-		log.Fatal("cannot conntect to databasse", err)
+		log.Fatal(err)
 	}
-	pingErr := s.DB.Ping()
-	if pingErr != nil {
-		log.Fatal(pingErr)
+	s.InitConfig(cfg)
+}
+
+// InitConfig connects to the database and sets up the routes and the workers
+// as cfg says.
+func (s *Server) InitConfig(cfg config.Config) {
+	var err error
+	s.Config = cfg
+	s.DB, err = Connect(cfg.DB)
+	if err != nil {
+		log.Fatal("cannot conntect to databasse ", err)
 	}
 
 	log.Println("DB connected!")
+	s.Health = health.NewChecker(s.DB, retry(cfg.DB))
+	s.Health.Check(context.Background())
+
+	s.Auth, err = authFromConfig(cfg.Auth)
+	if err != nil {
+		log.Fatal("invalid authentication settings ", err)
+	}
+	s.Auth.Permissions(routePermissions)
 
 	s.Router = mux.NewRouter()
+	s.Router.Use(s.Auth.Handler)
+	s.Router.Use(handlers.RecordActor)
 	s.Handlers = handlers.NewHandlerFunc(s.DB)
+	s.Handlers.SetHealth(s.Health)
+	if cfg.CheckInKey == "" {
+		log.Println("checkin_key is not set, check-in tokens will not survive a restart")
+	}
+	if err = s.Handlers.SetCheckInKey([]byte(cfg.CheckInKey)); err != nil {
+		log.Fatal("cannot set up check-in tokens ", err)
+	}
+	event := models.Event{Name: cfg.Event.Name, Venue: cfg.Event.Venue, Start: cfg.Event.Start, End: cfg.Event.End,
+		Domain: cfg.Event.Domain}
+	s.Handlers.SetEvent(event)
+	if cfg.Features.Webhooks {
+		s.Webhooks = webhook.NewDispatcher(database.NewSQLGuestRepo(s.DB))
+	} else {
+		log.Println("Webhooks are turned off, messages stay in the outbox")
+	}
+	if cfg.Features.Live {
+		s.Live = live.NewHub(database.NewSQLGuestRepo(s.DB))
+		s.Handlers.SetLive(s.Live)
+		s.Handlers.SetStreamLimit(streamLimit)
+	} else {
+		log.Println("Live updates are turned off")
+	}
+	s.Notifications = notificationsFromConfig(database.NewSQLGuestRepo(s.DB), cfg, event)
+	s.Router.HandleFunc("/ready", s.Handlers.GetReadiness).Methods("GET")
+	s.Router.HandleFunc("/whoami", s.Handlers.GetPrincipal).Methods("GET")
 	s.Router.HandleFunc("/tables", s.Handlers.CreateTable).Methods("POST")
 	s.Router.HandleFunc("/guest_list/{name}", s.Handlers.CreateGuestsListEntry).Methods("POST")
 	s.Router.HandleFunc("/guests/{name}", s.Handlers.UpdateGuestsList).Methods("PUT")
 	s.Router.HandleFunc("/guest_list", s.Handlers.GetGuestsList).Methods("GET")
+	s.Router.HandleFunc("/guest_list/search", s.Handlers.SearchGuests).Methods("GET")
+	s.Router.HandleFunc("/imports/guest_list", s.Handlers.ImportGuestsList).Methods("POST")
+	s.Router.HandleFunc("/sync/guest_list", s.Handlers.SyncGuestsList).Methods("POST")
 	s.Router.HandleFunc("/guests", s.Handlers.GetArrivedGuests).Methods("GET")
 	s.Router.HandleFunc("/seats_empty", s.Handlers.GetEmptySeats).Methods("GET")
+	s.Router.HandleFunc("/live", s.Handlers.StreamLiveUpdates).Methods("GET")
 	s.Router.HandleFunc("/guests/{name}", s.Handlers.GuestLeaves).Methods("DELETE")
+	s.Router.HandleFunc("/table_groups", s.Handlers.CreateTableGroup).Methods("POST")
+	s.Router.HandleFunc("/table_groups", s.Handlers.GetTableGroups).Methods("GET")
+	s.Router.HandleFunc("/guest_list/{name}/table", s.Handlers.MoveGuestsListEntry).Methods("PUT")
+	s.Router.HandleFunc("/tables/{id}/seats", s.Handlers.GetTableSeats).Methods("GET")
+	s.Router.HandleFunc("/guest_list/{name}/seats", s.Handlers.AssignSeats).Methods("PUT")
+	s.Router.HandleFunc("/guest_list/{name}/members", s.Handlers.GetPartyMembers).Methods("GET")
+	s.Router.HandleFunc("/guest_list/{name}/members", s.Handlers.AddPartyMember).Methods("POST")
+	s.Router.HandleFunc("/guest_list/{name}/members/{id}", s.Handlers.UpdatePartyMember).Methods("PUT")
+	s.Router.HandleFunc("/guest_list/{name}/members/{id}", s.Handlers.RemovePartyMember).Methods("DELETE")
+	s.Router.HandleFunc("/catering_report", s.Handlers.GetCateringReport).Methods("GET")
+	s.Router.HandleFunc("/invitations/{name}", s.Handlers.CreateInvitation).Methods("POST")
+	s.Router.HandleFunc("/invitations", s.Handlers.GetInvitations).Methods("GET")
+	s.Router.HandleFunc("/rsvp/{token}", s.Handlers.GetRsvp).Methods("GET")
+	s.Router.HandleFunc("/rsvp/{token}", s.Handlers.ChangeRsvp).Methods("PUT")
+	s.Router.HandleFunc("/rsvp/{token}/accept", s.Handlers.AcceptRsvp).Methods("POST")
+	s.Router.HandleFunc("/rsvp/{token}/decline", s.Handlers.DeclineRsvp).Methods("POST")
+	s.Router.HandleFunc("/portal/{token}", s.Handlers.GetOwnReservation).Methods("GET")
+	s.Router.HandleFunc("/portal/{token}", s.Handlers.ChangeOwnPartySize).Methods("PUT")
+	s.Router.HandleFunc("/portal/{token}/dietary", s.Handlers.UpdateOwnDietaryRequirements).Methods("PUT")
+	s.Router.HandleFunc("/portal/{token}", s.Handlers.CancelOwnReservation).Methods("DELETE")
+	s.Router.HandleFunc("/confirmations/{code}", s.Handlers.GetReservationByCode).Methods("GET")
+	s.Router.HandleFunc("/confirmations/{code}/arrival", s.Handlers.CheckInByCode).Methods("PUT")
+	s.Router.HandleFunc("/confirmations/{code}", s.Handlers.CancelByCode).Methods("DELETE")
+	s.Router.HandleFunc("/confirmations/{code}/qr.png", s.Handlers.GetCheckInQRByCode).Methods("GET")
+	s.Router.HandleFunc("/portal/{token}/qr.png", s.Handlers.GetOwnCheckInQR).Methods("GET")
+	s.Router.HandleFunc("/checkin", s.Handlers.CheckInWithToken).Methods("POST")
+	s.Router.HandleFunc("/event.ics", s.Handlers.GetEventCalendar).Methods("GET")
+	s.Router.HandleFunc("/admin/snapshot", s.Handlers.GetSnapshot).Methods("GET")
+	s.Router.HandleFunc("/admin/snapshot", s.Handlers.RestoreSnapshot).Methods("POST")
+	s.Router.HandleFunc("/admin/seat_check", s.Handlers.CheckSeats).Methods("GET")
+	s.Router.HandleFunc("/admin/seat_check/repair", s.Handlers.RepairSeats).Methods("POST")
+	s.Router.HandleFunc("/audit", s.Handlers.GetAuditLog).Methods("GET")
+	s.Router.HandleFunc("/notifications", s.Handlers.GetNotifications).Methods("GET")
+	s.Router.HandleFunc("/webhooks", s.Handlers.CreateWebhook).Methods("POST")
+	s.Router.HandleFunc("/webhooks", s.Handlers.GetWebhooks).Methods("GET")
+	s.Router.HandleFunc("/webhooks/{id}", s.Handlers.DeleteWebhook).Methods("DELETE")
+	s.Router.HandleFunc("/webhooks/{id}/deliveries", s.Handlers.GetWebhookDeliveries).Methods("GET")
+	s.Router.HandleFunc("/confirmations/{code}/reservation.ics", s.Handlers.GetReservationCalendarByCode).Methods("GET")
+	s.Router.HandleFunc("/portal/{token}/reservation.ics", s.Handlers.GetOwnReservationCalendar).Methods("GET")
+	if err = s.Auth.Check(s.Router); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func Run() {
-	app:= NewSerwer()
+// routePermissions is what each route needs. Door staff check guests in, hosts
+// also take reservations, and only admins set up tables, replace the guest
+// list and run the service. The routes guests reach with the secret token of
+// their own reservation need no credentials.
+var routePermissions = map[string]auth.Permission{
+	"GET /ready":                                auth.Public,
+	"GET /whoami":                               auth.Read,
+	"POST /tables":                              auth.Admin,
+	"POST /guest_list/{name}":                   auth.Reservations,
+	"PUT /guests/{name}":                        auth.CheckIn,
+	"GET /guest_list":                           auth.Read,
+	"GET /guest_list/search":                    auth.Read,
+	"POST /imports/guest_list":                  auth.Admin,
+	"POST /sync/guest_list":                     auth.Admin,
+	"GET /guests":                               auth.Read,
+	"GET /seats_empty":                          auth.Read,
+	"GET /live":                                 auth.Read,
+	"DELETE /guests/{name}":                     auth.CheckIn,
+	"POST /table_groups":                        auth.Admin,
+	"GET /table_groups":                         auth.Read,
+	"PUT /guest_list/{name}/table":              auth.Reservations,
+	"GET /tables/{id}/seats":                    auth.Read,
+	"PUT /guest_list/{name}/seats":              auth.Reservations,
+	"GET /guest_list/{name}/members":            auth.Read,
+	"POST /guest_list/{name}/members":           auth.Reservations,
+	"PUT /guest_list/{name}/members/{id}":       auth.Reservations,
+	"DELETE /guest_list/{name}/members/{id}":    auth.Reservations,
+	"GET /catering_report":                      auth.Read,
+	"POST /invitations/{name}":                  auth.Reservations,
+	"GET /invitations":                          auth.Read,
+	"GET /rsvp/{token}":                         auth.Public,
+	"PUT /rsvp/{token}":                         auth.Public,
+	"POST /rsvp/{token}/accept":                 auth.Public,
+	"POST /rsvp/{token}/decline":                auth.Public,
+	"GET /portal/{token}":                       auth.Public,
+	"PUT /portal/{token}":                       auth.Public,
+	"PUT /portal/{token}/dietary":               auth.Public,
+	"DELETE /portal/{token}":                    auth.Public,
+	"GET /confirmations/{code}":                 auth.Read,
+	"PUT /confirmations/{code}/arrival":         auth.CheckIn,
+	"DELETE /confirmations/{code}":              auth.Reservations,
+	"GET /confirmations/{code}/qr.png":          auth.CheckIn,
+	"GET /portal/{token}/qr.png":                auth.Public,
+	"POST /checkin":                             auth.CheckIn,
+	"GET /event.ics":                            auth.Public,
+	"GET /admin/snapshot":                       auth.Admin,
+	"POST /admin/snapshot":                      auth.Admin,
+	"GET /admin/seat_check":                     auth.Admin,
+	"POST /admin/seat_check/repair":             auth.Admin,
+	"GET /audit":                                auth.Read,
+	"GET /notifications":                        auth.Admin,
+	"POST /webhooks":                            auth.Admin,
+	"GET /webhooks":                             auth.Admin,
+	"DELETE /webhooks/{id}":                     auth.Admin,
+	"GET /webhooks/{id}/deliveries":             auth.Admin,
+	"GET /confirmations/{code}/reservation.ics": auth.Read,
+	"GET /portal/{token}/reservation.ics":       auth.Public,
+}
 
-	err := godotenv.Load("../../.env")
-	if err!=nil {
-		log.Printf("Couldn't load .env file %v", err)
-		return
+// authFromConfig accepts the API keys of cfg and bearer tokens signed with
+// its JWT secret. With neither the API is open.
+func authFromConfig(cfg config.Auth) (*auth.Middleware, error) {
+	var authenticators []auth.Authenticator
+	if cfg.APIKeys != "" {
+		keys, err := auth.ParseAPIKeys(cfg.APIKeys)
+		if err != nil {
+			return nil, fmt.Errorf("auth.api_keys: %v", err)
+		}
+		authenticators = append(authenticators, keys)
 	}
+	if cfg.JWTSecret != "" {
+		authenticators = append(authenticators, auth.NewJWT([]byte(cfg.JWTSecret), cfg.JWTIssuer, cfg.JWTAudience))
+	}
+	if len(authenticators) == 0 {
+		log.Println("auth.api_keys and auth.jwt_secret are not set, the API is open to anyone")
+	}
+	return auth.NewMiddleware(authenticators...), nil
+}
 
-	app.Init(os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
-	http.ListenAndServe(":3000", app.Router)
+// notificationsFromConfig sends notifications through the SMTP server of cfg;
+// nil when they are turned off or no server is set.
+func notificationsFromConfig(store notify.Store, cfg config.Config, event models.Event) *notify.Sender {
+	if !cfg.Features.Notifications {
+		log.Println("Notifications are turned off, they are queued but not sent")
+		return nil
+	}
+	if cfg.SMTP.Addr == "" {
+		log.Println("smtp.addr is not set, notifications are queued but not sent")
+		return nil
+	}
+	notifier := notify.NewSMTP(cfg.SMTP.Addr, cfg.SMTP.From, cfg.SMTP.Username, cfg.SMTP.Password)
+	return notify.NewSender(store, notifier, event, cfg.ReminderLead)
 }
 
+// Serve answers requests on l and runs the webhook, notification and live
+// update workers until ctx is done. It then stops taking connections, ends
+// the live streams, gives the requests in flight shutdownTimeout to finish and
+// closes the database.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{
+		Handler:           s.Router,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.Health.Run(workers, healthInterval)
+	}()
+	if s.Webhooks != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Webhooks.Run(workers, webhookInterval)
+		}()
+	}
+	if s.Notifications != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Notifications.Run(workers, notificationInterval)
+		}()
+	}
+	if s.Live != nil {
+		if err := s.Live.Start(workers); err != nil {
+			stopWorkers()
+			wg.Wait()
+			s.DB.Close()
+			return fmt.Errorf("cannot start live updates: %v", err)
+		}
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(l)
+	}()
+	var err error
+	select {
+	case err = <-served:
+	case <-ctx.Done():
+		log.Println("Shutting down, draining requests in flight")
+		// Stopping the live updates ends the streams, which would otherwise
+		// keep their connections busy until the timeout.
+		stopWorkers()
+		drain, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err = srv.Shutdown(drain); err != nil {
+			log.Printf("requests still in flight were cut off: %v", err)
+			srv.Close()
+		}
+		<-served
+	}
+	stopWorkers()
+	wg.Wait()
+	if closeErr := s.DB.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Run serves the API as configured by the flags in args, the environment and
+// the config file, until it gets SIGTERM or SIGINT.
+func Run(args []string) {
+	cfg, err := config.Load(args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	var effective strings.Builder
+	cfg.Print(&effective)
+	log.Printf("Configuration:\n%s", effective.String())
+
+	app:= NewSerwer()
+	app.InitConfig(cfg)
+	repo := database.NewSQLGuestRepo(app.DB)
+	if err := repo.Migrate(context.Background()); err != nil {
+		log.Fatal("cannot migrate the database ", err)
+	}
+	if n, err := repo.BackfillSeats(context.Background()); err != nil {
+		log.Fatal("cannot backfill the seats ", err)
+	} else if n > 0 {
+		log.Printf("backfilled the seats of %d tables", n)
+	}
+	l, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		log.Fatal("cannot listen ", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("Listening on %s", l.Addr())
+	if err = app.Serve(ctx, l); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Stopped")
+}
@@ -0,0 +1,180 @@
+package snapshot
+
+import (
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+)
+
+// Version is the snapshot format written by this service. It changes whenever
+// a snapshot would no longer restore the same state. Version 2 added the email
+// addresses and whether a reservation came from an invitation.
+const Version = 2
+
+// oldestVersion is the oldest format that is still restored; see Upgrade.
+const oldestVersion = 1
+
+// Upgrade brings a snapshot of an older version up to Version. A version 1
+// snapshot has no email addresses, and its invitations are the reservations
+// still invited or declined; ones already accepted restore as plain
+// reservations.
+func Upgrade(s *models.Snapshot) {
+	if s.Version == 1 {
+		for i := range s.Reservations {
+			r := &s.Reservations[i]
+			r.Invited = r.Status == models.Invited || r.Status == models.Declined
+		}
+	}
+	s.Version = Version
+}
+
+// Validate checks that a snapshot describes a consistent seating plan before
+// anything is restored from it: every table's counters add up to its capacity
+// and match its seats, no table is over capacity, and every party holds
+// exactly the seats it booked. All problems are reported.
+func Validate(s *models.Snapshot) []string {
+	if s.Version < oldestVersion || s.Version > Version {
+		return []string{fmt.Sprintf("unsupported snapshot version %d, expected %d to %d", s.Version, oldestVersion,
+			Version)}
+	}
+
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	reservations := map[int64]*models.SnapshotReservation{}
+	tokens := map[string]bool{}
+	codes := map[string]bool{}
+	for i := range s.Reservations {
+		r := &s.Reservations[i]
+		if r.Id <= 0 || reservations[r.Id] != nil {
+			report("reservation %q: invalid or repeated id %d", r.Name, r.Id)
+			continue
+		}
+		reservations[r.Id] = r
+		if r.Name == "" {
+			report("reservation %d: the name is empty", r.Id)
+		}
+		if r.Status < models.Upcoming || r.Status > models.Cancelled {
+			report("reservation %d: unknown status %d", r.Id, r.Status)
+		}
+		if !models.ValidEmail(r.Email) {
+			report("reservation %d: invalid email %q", r.Id, r.Email)
+		}
+		if r.Token != "" && tokens[r.Token] {
+			report("reservation %d: the token is used twice", r.Id)
+		}
+		tokens[r.Token] = true
+		if r.ConfirmationCode != "" && codes[r.ConfirmationCode] {
+			report("reservation %d: confirmation code %s is used twice", r.Id, r.ConfirmationCode)
+		}
+		codes[r.ConfirmationCode] = true
+		if len(r.Members) > 0 && int64(len(r.Members)) >= r.AccompanyingGuests {
+			report("reservation %d: %d named guests in a party of %d", r.Id, len(r.Members), r.AccompanyingGuests)
+		}
+	}
+
+	tables := map[int64]bool{}
+	// held counts the seats of each reservation per table.
+	held := map[int64]map[int32]int64{}
+	for _, t := range s.Tables {
+		if t.Id <= 0 || tables[t.Id] {
+			report("table %d: invalid or repeated id", t.Id)
+			continue
+		}
+		tables[t.Id] = true
+		if t.Capacity < 0 || t.BookedSeats < 0 || t.AvailableSeats < 0 {
+			report("table %d: negative capacity or counters", t.Id)
+		}
+		if t.BookedSeats+t.AvailableSeats != t.Capacity {
+			report("table %d: %d booked + %d available seats do not make the capacity of %d",
+				t.Id, t.BookedSeats, t.AvailableSeats, t.Capacity)
+		}
+		if t.BookedSeats > t.Capacity {
+			report("table %d: %d seats booked over a capacity of %d", t.Id, t.BookedSeats, t.Capacity)
+		}
+		if len(t.Seats) != t.Capacity {
+			report("table %d: %d seats for a capacity of %d", t.Id, len(t.Seats), t.Capacity)
+		}
+
+		positions := map[int]bool{}
+		booked := 0
+		for _, seat := range t.Seats {
+			if seat.Position < 1 || seat.Position > t.Capacity || positions[seat.Position] {
+				report("table %d: invalid or repeated seat position %d", t.Id, seat.Position)
+			}
+			positions[seat.Position] = true
+			if seat.ReservationId == 0 {
+				continue
+			}
+			booked++
+			r := reservations[seat.ReservationId]
+			if r == nil {
+				report("table %d: seat %d is held by unknown reservation %d", t.Id, seat.Position, seat.ReservationId)
+				continue
+			}
+			if !r.Status.HoldsSeats() {
+				report("table %d: seat %d is held by reservation %d, which holds no seats in status %d",
+					t.Id, seat.Position, r.Id, r.Status)
+			}
+			if held[r.Id] == nil {
+				held[r.Id] = map[int32]int64{}
+			}
+			held[r.Id][int32(t.Id)]++
+		}
+		if booked != t.BookedSeats {
+			report("table %d: %d seats are held but %d are counted as booked", t.Id, booked, t.BookedSeats)
+		}
+	}
+
+	groups := map[int64]bool{}
+	for _, g := range s.TableGroups {
+		if g.Id <= 0 || groups[g.Id] {
+			report("table group %d: invalid or repeated id", g.Id)
+			continue
+		}
+		groups[g.Id] = true
+		for _, tableId := range g.TableIds {
+			if !tables[int64(tableId)] {
+				report("table group %d: unknown table %d", g.Id, tableId)
+			}
+		}
+	}
+
+	for _, r := range s.Reservations {
+		if reservations[r.Id] == nil {
+			continue
+		}
+		if r.TableId != 0 && !tables[int64(r.TableId)] {
+			report("reservation %d: unknown table %d", r.Id, r.TableId)
+		}
+		if r.TableGroupId != 0 && !groups[r.TableGroupId] {
+			report("reservation %d: unknown table group %d", r.Id, r.TableGroupId)
+		}
+
+		var total int64
+		for _, seats := range held[r.Id] {
+			total += seats
+		}
+		want := r.AccompanyingGuests
+		if !r.Status.HoldsSeats() {
+			want = 0
+		}
+		if total != want {
+			report("reservation %d: holds %d seats for a party of %d", r.Id, total, want)
+		}
+
+		var allocated int64
+		for _, a := range r.Tables {
+			if held[r.Id][a.TableId] != a.Seats {
+				report("reservation %d: %d seats allocated at table %d but %d held",
+					r.Id, a.Seats, a.TableId, held[r.Id][a.TableId])
+			}
+			allocated += a.Seats
+		}
+		if allocated != total {
+			report("reservation %d: %d seats allocated but %d held", r.Id, allocated, total)
+		}
+	}
+	return problems
+}
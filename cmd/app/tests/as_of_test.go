@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSeatingAsOf(t *testing.T)  {
+	clearTable()
+	ensureTableExists()
+	defer func() {
+		clearTable()
+		ensureTableExists()
+	}()
+
+	run := func(method, url, args string) {
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer([]byte(args)))
+		req.Header.Set("Content-Type", "application/json")
+		if response := executeRequest(req); response.Code >= 300 {
+			t.Fatalf("%s %s failed with %d: %s", method, url, response.Code, response.Body.String())
+		}
+	}
+	// The log is moved back in time so that the changes happened two hours
+	// and one hour ago.
+	run("POST", "/tables", `{"capacity":10}`)
+	run("POST", "/guest_list/Jo", `{"accompanying_guests":2, "table_id":1}`)
+	run("POST", "/guest_list/Kit", `{"accompanying_guests":3, "table_id":1}`)
+	app.DB.Exec("UPDATE audit_log SET occurred_at = occurred_at - 7200")
+	run("PUT", "/guests/Jo", `{"accompanying_guests":4}`)
+	app.DB.Exec("UPDATE audit_log SET occurred_at = occurred_at - 3600 WHERE action = ?", models.AuditArrived)
+	run("DELETE", "/guests/Kit", ``)
+
+	now := time.Now().UTC()
+	at := func(d time.Duration) string {
+		return "?as_of=" + now.Add(d).Format(time.RFC3339)
+	}
+	tests:= []struct{
+		name 		string
+		query 		string
+		wantedGuests	map[string]int64
+		wantedArrived	map[string]int64
+		wantedSeats	int32
+	}{
+		{
+			name: "test if nothing existed before the first change",
+			query: at(-3 * time.Hour),
+			wantedGuests: map[string]int64{},
+			wantedArrived: map[string]int64{},
+		},
+		{
+			name: "test if both parties were booked before the arrival",
+			query: at(-90 * time.Minute),
+			wantedGuests: map[string]int64{"Jo": 2, "Kit": 3},
+			wantedArrived: map[string]int64{},
+			wantedSeats: 5,
+		},
+		{
+			name: "test if the arrival of a larger party is seen",
+			query: at(-30 * time.Minute),
+			wantedGuests: map[string]int64{"Jo": 4, "Kit": 3},
+			wantedArrived: map[string]int64{"Jo": 4},
+			wantedSeats: 3,
+		},
+		{
+			name: "test if the plan as of now matches the live one",
+			query: at(time.Minute),
+			wantedGuests: map[string]int64{"Jo": 4, "Kit": 3},
+			wantedArrived: map[string]int64{"Jo": 4},
+			wantedSeats: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, list := range []struct{
+				url 		string
+				want 		map[string]int64
+			}{{"/guest_list", tt.wantedGuests}, {"/guests", tt.wantedArrived}} {
+				req, _ := http.NewRequest("GET", list.url+tt.query, nil)
+				response := executeRequest(req)
+				checkResponseCode(t, http.StatusOK, response.Code)
+				var guests models.GuestList
+				json.Unmarshal(response.Body.Bytes(), &guests)
+				got := map[string]int64{}
+				for _, g := range guests.Guests {
+					got[g.Name] = g.AccompanyingGuests
+				}
+				if len(got) != len(list.want) {
+					t.Errorf("Expected %v on %s. Got %v", list.want, list.url, got)
+				}
+				for name, size := range list.want {
+					if got[name] != size {
+						t.Errorf("Expected %v on %s. Got %v", list.want, list.url, got)
+					}
+				}
+			}
+
+			req, _ := http.NewRequest("GET", "/seats_empty"+tt.query, nil)
+			var seats models.Seats
+			json.Unmarshal(executeRequest(req).Body.Bytes(), &seats)
+			if seats.SeatsEmpty != tt.wantedSeats {
+				t.Errorf("Expected %v empty seats. Got %v", tt.wantedSeats, seats.SeatsEmpty)
+			}
+		})
+	}
+
+	req, _ := http.NewRequest("GET", "/seats_empty?as_of=9pm", nil)
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+}
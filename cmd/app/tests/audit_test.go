@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T)  {
+	clearTable()
+	ensureTableExists()
+	defer func() {
+		clearTable()
+		ensureTableExists()
+	}()
+
+	steps:= []struct{
+		method 		string
+		url 		string
+		args 		string
+	}{
+		{"POST", "/tables", `{"capacity":10}`},
+		{"POST", "/tables", `{"capacity":4}`},
+		{"POST", "/guest_list/Jo", `{"accompanying_guests":2, "table_id":1}`},
+		{"PUT", "/guest_list/Jo/table", `{"table_id":2}`},
+		{"PUT", "/guests/Jo", `{"accompanying_guests":3}`},
+		{"DELETE", "/guests/Jo", ``},
+		{"POST", "/guest_list/Kit", `{"accompanying_guests":1, "table_id":1}`},
+	}
+	for _, step := range steps {
+		req, _ := http.NewRequest(step.method, step.url, bytes.NewBuffer([]byte(step.args)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Actor", "front desk")
+		if response := executeRequest(req); response.Code >= 300 {
+			t.Fatalf("%s %s failed with %d: %s", step.method, step.url, response.Code, response.Body.String())
+		}
+	}
+
+	tests:= []struct{
+		name 		string
+		query 		string
+		want 		int
+		wantedActions	[]string
+	}{
+		{
+			name: "test if every change is recorded in order",
+			want: 200,
+			wantedActions: []string{models.AuditTableCreated, models.AuditTableCreated, models.AuditReservationCreated,
+				models.AuditMoved, models.AuditArrived, models.AuditLeft, models.AuditReservationCreated},
+		},
+		{
+			name: "test if the log is filtered by reservation",
+			query: "?reservation_id=1",
+			want: 200,
+			wantedActions: []string{models.AuditReservationCreated, models.AuditMoved, models.AuditArrived, models.AuditLeft},
+		},
+		{
+			name: "test if the log is filtered by table, before and after a move",
+			query: "?table_id=2",
+			want: 200,
+			wantedActions: []string{models.AuditTableCreated, models.AuditMoved, models.AuditArrived, models.AuditLeft},
+		},
+		{
+			name: "test if the log is paged",
+			query: "?after_id=5&limit=1",
+			want: 200,
+			wantedActions: []string{models.AuditLeft},
+		},
+		{
+			name: "test if nothing is found before the changes",
+			query: "?to=2000-01-01T00:00:00Z",
+			want: 200,
+			wantedActions: []string{},
+		},
+		{
+			name: "test if an invalid time is refused",
+			query: "?from=yesterday",
+			want: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/audit"+tt.query, nil)
+			response := executeRequest(req)
+			checkResponseCode(t, tt.want, response.Code)
+			if response.Code != http.StatusOK {
+				return
+			}
+			var log models.AuditLog
+			json.Unmarshal(response.Body.Bytes(), &log)
+			actions := []string{}
+			for _, e := range log.Entries {
+				actions = append(actions, e.Action)
+			}
+			if len(actions) != len(tt.wantedActions) {
+				t.Fatalf("Expected actions %v. Got %v", tt.wantedActions, actions)
+			}
+			for i := range actions {
+				if actions[i] != tt.wantedActions[i] {
+					t.Errorf("Expected actions %v. Got %v", tt.wantedActions, actions)
+					break
+				}
+			}
+		})
+	}
+
+	req, _ := http.NewRequest("GET", "/audit?reservation_id=1", nil)
+	var log models.AuditLog
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &log)
+	if len(log.Entries) < 3 {
+		t.Fatalf("Expected the arrival of Jo to be recorded. Got %+v", log.Entries)
+	}
+	arrival := log.Entries[2]
+	var before, after models.ReservationState
+	json.Unmarshal(arrival.Before, &before)
+	json.Unmarshal(arrival.After, &after)
+	if arrival.Actor != "anonymous" {
+		t.Errorf("Expected the change to be made by anonymous, whatever X-Actor says. Got %q", arrival.Actor)
+	}
+	if before.AccompanyingGuests != 2 || before.Status != models.Upcoming || after.AccompanyingGuests != 3 ||
+		after.Status != models.Attended || len(after.Tables) != 1 || after.Tables[0].Seats != 3 {
+		t.Errorf("Expected a party of 2 to arrive as 3. Got %+v, then %+v", before, after)
+	}
+
+	// An entry can concern more tables than fit in a column of ids.
+	var ids []string
+	for i := 0; i < 80; i++ {
+		req, _ = http.NewRequest("POST", "/tables", bytes.NewBuffer([]byte(`{"capacity":1}`)))
+		var table models.Table
+		json.Unmarshal(executeRequest(req).Body.Bytes(), &table)
+		ids = append(ids, fmt.Sprint(table.Id))
+	}
+	req, _ = http.NewRequest("POST", "/table_groups",
+		bytes.NewBuffer([]byte(`{"name":"hall", "table_ids":[`+strings.Join(ids, ",")+`]}`)))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("GET", "/audit?table_id="+ids[len(ids)-1], nil)
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &log)
+	if n := len(log.Entries); n != 2 || log.Entries[1].Action != models.AuditTableGroupCreated ||
+		len(log.Entries[1].TableIds) != len(ids) {
+		t.Errorf("Expected the group of %d tables to be recorded. Got %+v", len(ids), log.Entries)
+	}
+}
+
+func TestSyncNotifications(t *testing.T)  {
+	clearTable()
+	ensureTableExists()
+	defer func() {
+		clearTable()
+		ensureTableExists()
+	}()
+
+	run := func(method, url, body string) *bytes.Buffer {
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		return response.Body
+	}
+	run("POST", "/tables", `{"capacity":10}`)
+	run("POST", "/tables", `{"capacity":10}`)
+
+	tests:= []struct{
+		name 		string
+		args 		string
+		wantedKinds	[]string
+	}{
+		{
+			name: "test if a synced guest gets a confirmation",
+			args: `{"guests":[{"name":"Lou","table_id":1,"accompanying_guests":2,"email":"lou@example.com"}]}`,
+			wantedKinds: []string{models.NotifyBookingConfirmed},
+		},
+		{
+			name: "test if a sync that moves a guest tells them",
+			args: `{"guests":[{"name":"Lou","table_id":2,"accompanying_guests":2,"email":"lou@example.com"}]}`,
+			wantedKinds: []string{models.NotifyBookingConfirmed, models.NotifyTableChanged},
+		},
+		{
+			name: "test if a sync that keeps the table says nothing",
+			args: `{"guests":[{"name":"Lou","table_id":2,"accompanying_guests":3,"email":"lou@example.com"}]}`,
+			wantedKinds: []string{models.NotifyBookingConfirmed, models.NotifyTableChanged},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run("POST", "/sync/guest_list", tt.args)
+			var list models.NotificationList
+			json.Unmarshal(run("GET", "/notifications?reservation_id=1", "").Bytes(), &list)
+			var kinds []string
+			for _, n := range list.Notifications {
+				kinds = append(kinds, n.Kind)
+			}
+			if fmt.Sprint(kinds) != fmt.Sprint(tt.wantedKinds) {
+				t.Errorf("Expected notifications %v. Got %v", tt.wantedKinds, kinds)
+			}
+		})
+	}
+}
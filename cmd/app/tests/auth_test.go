@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/auth"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/server"
+	"github.com/golang-jwt/jwt/v4"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testJWTSecret = "a test secret that is long enough"
+
+func TestAuthentication(t *testing.T)  {
+	clearTable()
+	ensureTableExists()
+	defer func() {
+		clearTable()
+		ensureTableExists()
+	}()
+
+	os.Setenv("API_KEYS", "door-1:door:"+auth.HashKey("door key")+", ops:admin:"+auth.HashKey("admin key")+
+		", lobby:read-only:"+auth.HashKey("lobby key"))
+	os.Setenv("JWT_SECRET", testJWTSecret)
+	secured := api.NewSerwer()
+	secured.Init(os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"),
+		os.Getenv("DB_NAME"))
+	os.Unsetenv("API_KEYS")
+	os.Unsetenv("JWT_SECRET")
+	defer secured.DB.Close()
+
+	token := func(secret string, method jwt.SigningMethod, claims jwt.RegisteredClaims, role auth.Role) string {
+		signed, err := jwt.NewWithClaims(method, auth.Claims{RegisteredClaims: claims, Role: role}).
+			SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + signed
+	}
+	inAnHour := jwt.NewNumericDate(time.Now().Add(time.Hour))
+	valid := token(testJWTSecret, jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "ops", ExpiresAt: inAnHour},
+		auth.RoleAdmin)
+	host := token(testJWTSecret, jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "front desk",
+		ExpiresAt: inAnHour}, auth.RoleHost)
+
+	tests:= []struct{
+		name 		string
+		method 		string
+		url 		string
+		header 		string
+		value 		string
+		want 		int
+		principal 	auth.Principal
+	}{
+		{"without credentials", "GET", "/whoami", "", "", http.StatusUnauthorized, auth.Principal{}},
+		{"with an unknown API key", "GET", "/whoami", "X-API-Key", "other key", http.StatusUnauthorized, auth.Principal{}},
+		{"with an API key", "GET", "/whoami", "X-API-Key", "door key", http.StatusOK,
+			auth.Principal{Name: "door-1", Role: auth.RoleDoor, Method: auth.MethodAPIKey}},
+		{"with an admin API key", "GET", "/whoami", "X-API-Key", "admin key", http.StatusOK,
+			auth.Principal{Name: "ops", Role: auth.RoleAdmin, Method: auth.MethodAPIKey}},
+		{"with a token", "GET", "/whoami", "Authorization", valid, http.StatusOK,
+			auth.Principal{Name: "ops", Role: auth.RoleAdmin, Method: auth.MethodJWT}},
+		{"with an expired token", "GET", "/whoami", "Authorization",
+			token(testJWTSecret, jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "ops",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))}, auth.RoleAdmin),
+			http.StatusUnauthorized, auth.Principal{}},
+		{"with a token without expiry", "GET", "/whoami", "Authorization",
+			token(testJWTSecret, jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "ops"}, auth.RoleAdmin),
+			http.StatusUnauthorized, auth.Principal{}},
+		{"with a token without a role", "GET", "/whoami", "Authorization",
+			token(testJWTSecret, jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "ops", ExpiresAt: inAnHour}, ""),
+			http.StatusUnauthorized, auth.Principal{}},
+		{"with a token signed with another secret", "GET", "/whoami", "Authorization",
+			token("another secret that is long enough", jwt.SigningMethodHS256,
+				jwt.RegisteredClaims{Subject: "ops", ExpiresAt: inAnHour}, auth.RoleAdmin),
+			http.StatusUnauthorized, auth.Principal{}},
+		{"with a token signed with another algorithm", "GET", "/whoami", "Authorization",
+			token(testJWTSecret, jwt.SigningMethodHS512, jwt.RegisteredClaims{Subject: "ops", ExpiresAt: inAnHour},
+				auth.RoleAdmin),
+			http.StatusUnauthorized, auth.Principal{}},
+		{"of door staff creating a table", "POST", "/tables", "X-API-Key", "door key", http.StatusForbidden,
+			auth.Principal{}},
+		{"of door staff wiping the guest list", "POST", "/sync/guest_list", "X-API-Key", "door key",
+			http.StatusForbidden, auth.Principal{}},
+		{"of door staff checking a guest in without a body", "POST", "/checkin", "X-API-Key", "door key",
+			http.StatusBadRequest, auth.Principal{}},
+		{"of a host creating a table", "POST", "/tables", "Authorization", host, http.StatusForbidden,
+			auth.Principal{}},
+		{"of a host cancelling a reservation", "DELETE", "/confirmations/unknown", "Authorization", host,
+			http.StatusNotFound, auth.Principal{}},
+		{"of a read-only principal checking a guest in", "PUT", "/confirmations/unknown/arrival", "X-API-Key",
+			"lobby key", http.StatusForbidden, auth.Principal{}},
+		{"of a read-only principal getting a check-in QR code", "GET", "/confirmations/unknown/qr.png", "X-API-Key",
+			"lobby key", http.StatusForbidden, auth.Principal{}},
+		{"of door staff getting a check-in QR code", "GET", "/confirmations/unknown/qr.png", "X-API-Key",
+			"door key", http.StatusNotFound, auth.Principal{}},
+		{"of a read-only principal reading the guest list", "GET", "/guest_list", "X-API-Key", "lobby key",
+			http.StatusOK, auth.Principal{}},
+		{"on a guest route without credentials", "GET", "/portal/unknown", "", "", http.StatusNotFound, auth.Principal{}},
+	}
+	for _, tt := range tests {
+		t.Run("test if a request "+tt.name+" is answered with "+http.StatusText(tt.want), func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.url, bytes.NewBuffer(nil))
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			response := httptest.NewRecorder()
+			secured.Router.ServeHTTP(response, req)
+			checkResponseCode(t, tt.want, response.Code)
+			if tt.want == http.StatusUnauthorized && response.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("Expected a WWW-Authenticate header")
+			}
+			if tt.want == http.StatusForbidden && !strings.Contains(response.Body.String(), "permission") {
+				t.Errorf("Expected the missing permission to be named. Got %s", response.Body.String())
+			}
+			if tt.principal.Name != "" {
+				var p auth.Principal
+				json.Unmarshal(response.Body.Bytes(), &p)
+				if p != tt.principal {
+					t.Errorf("Expected principal %+v. Got %+v", tt.principal, p)
+				}
+			}
+		})
+	}
+
+	t.Run("test if the audit log names the principal rather than X-Actor", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/tables", bytes.NewBuffer([]byte(`{"capacity":4}`)))
+		req.Header.Set("X-API-Key", "admin key")
+		req.Header.Set("X-Actor", "someone else")
+		response := httptest.NewRecorder()
+		secured.Router.ServeHTTP(response, req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		req, _ = http.NewRequest("GET", "/audit", nil)
+		req.Header.Set("Authorization", valid)
+		response = httptest.NewRecorder()
+		secured.Router.ServeHTTP(response, req)
+		var log models.AuditLog
+		json.Unmarshal(response.Body.Bytes(), &log)
+		if len(log.Entries) != 1 || log.Entries[0].Actor != "ops" {
+			t.Errorf("Expected the table to be created by ops. Got %+v", log.Entries)
+		}
+	})
+
+	t.Run("test if a read-only principal lists invitations without their tokens", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/invitations/Pat",
+			bytes.NewBuffer([]byte(`{"accompanying_guests":2, "table_id":1}`)))
+		req.Header.Set("X-API-Key", "admin key")
+		response := httptest.NewRecorder()
+		secured.Router.ServeHTTP(response, req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var invitation models.GuestsReservation
+		json.Unmarshal(response.Body.Bytes(), &invitation)
+
+		req, _ = http.NewRequest("GET", "/invitations", nil)
+		req.Header.Set("X-API-Key", "lobby key")
+		response = httptest.NewRecorder()
+		secured.Router.ServeHTTP(response, req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var invitations models.GuestList
+		json.Unmarshal(response.Body.Bytes(), &invitations)
+		if len(invitations.Guests) != 1 || invitations.Guests[0].Name != "Pat" || invitation.RsvpToken == "" ||
+			strings.Contains(response.Body.String(), invitation.RsvpToken) {
+			t.Errorf("Expected Pat to be listed without a token. Got %s", response.Body.String())
+		}
+	})
+
+	t.Run("test if the API stays open without credentials configured", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/whoami", nil)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+	})
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/ical"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCalendar(t *testing.T) {
+	start := time.Date(2026, 6, 20, 18, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	var b bytes.Buffer
+	err := ical.Write(&b, []ical.Event{{
+		UID:         "event@example.com",
+		Summary:     "Summer dinner; drinks, music",
+		Description: strings.Repeat("Ünïcödé ", 20),
+		Start:       start,
+	}}, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{"BEGIN:VCALENDAR\r\n", "DTSTART:20260620T163000Z\r\n",
+		`SUMMARY:Summer dinner\; drinks\, music` + "\r\n", "END:VCALENDAR\r\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in the calendar. Got %q", want, out)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Expected lines of at most 75 octets. Got %d in %q", len(line), line)
+		}
+	}
+	if strings.Contains(out, "�") || !strings.Contains(strings.ReplaceAll(out, "\r\n ", ""), strings.Repeat("Ünïcödé ", 20)) {
+		t.Errorf("Expected the description to survive folding. Got %q", out)
+	}
+}
+
+func TestReservationCalendar(t *testing.T)  {
+	clearTable()
+	ensureTableExists()
+	defer func() {
+		clearTable()
+		ensureTableExists()
+		app.Handlers.SetEvent(models.Event{})
+	}()
+
+	req, _ := http.NewRequest("GET", "/event.ics", nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+
+	app.Handlers.SetEvent(models.Event{Name: "Summer dinner", Venue: "Old Mill",
+		Start: time.Date(2026, 6, 20, 18, 30, 0, 0, time.UTC), End: time.Date(2026, 6, 20, 23, 0, 0, 0, time.UTC),
+		Domain: "dinner.example.com"})
+
+	req, _ = http.NewRequest("POST", "/tables", bytes.NewBuffer([]byte(`{"capacity":10}`)))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("POST", "/guest_list/Mia", bytes.NewBuffer([]byte(`{"accompanying_guests":2, "table_id":1}`)))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var guest models.GuestDto
+	json.Unmarshal(response.Body.Bytes(), &guest)
+
+	tests:= []struct{
+		name 		string
+		url 		string
+		want 		int
+		wantedLines	[]string
+	}{
+		{
+			name: "test if the event calendar is sent",
+			url: "/event.ics",
+			want: 200,
+			wantedLines: []string{"SUMMARY:Summer dinner", "LOCATION:Old Mill", "DTSTART:20260620T183000Z",
+				"DTEND:20260620T230000Z", "UID:event@dinner.example.com"},
+		},
+		{
+			name: "test if a reservation is found by its confirmation code",
+			url: "/confirmations/" + guest.ConfirmationCode + "/reservation.ics",
+			want: 200,
+			wantedLines: []string{"LOCATION:Old Mill\\, Table 1", "STATUS:CONFIRMED",
+				"UID:reservation-" + guest.ConfirmationCode + "@dinner.example.com"},
+		},
+		{
+			name: "test if a guest can download their own reservation",
+			url: "/portal/" + guest.RsvpToken + "/reservation.ics",
+			want: 200,
+			wantedLines: []string{"DESCRIPTION:Reservation for Mia\\, party of 2.\\nConfirmation code: " +
+				guest.ConfirmationCode, "UID:reservation-" + guest.ConfirmationCode + "@dinner.example.com"},
+		},
+		{
+			name: "test if an unknown code is reported",
+			url: "/confirmations/AAAAAA/reservation.ics",
+			want: 404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The UIDs do not depend on the host name the file is fetched by.
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			req.Host = "internal.example:8080"
+			response := executeRequest(req)
+			checkResponseCode(t, tt.want, response.Code)
+			for _, want := range tt.wantedLines {
+				if !strings.Contains(response.Body.String(), "\r\n"+want) {
+					t.Errorf("Expected a line starting with %q. Got %q", want, response.Body.String())
+				}
+			}
+		})
+	}
+}
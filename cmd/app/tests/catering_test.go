@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"testing"
+)
+
+func TestCateringReport(t *testing.T)  {
+	clearTable()
+	ensureTableExists()
+	defer func() {
+		clearTable()
+		ensureTableExists()
+	}()
+
+	steps:= []struct{
+		method 		string
+		url 		string
+		args 		string
+	}{
+		{"POST", "/tables", `{"capacity":10}`},
+		{"POST", "/guest_list/Gina", `{"accompanying_guests":2, "table_id":1, "diet":"vegan", "gluten_free":true}`},
+		{"POST", "/guest_list/Gina/members", `{"name":"Hal", "diet":"vegetarian", "nut_allergy":true}`},
+		{"POST", "/guest_list/Ian", `{"accompanying_guests":1, "table_id":1, "diet":"vegetarian"}`},
+		{"DELETE", "/guests/Ian", ``},
+		{"POST", "/tables", `{"capacity":2}`},
+		{"POST", "/tables", `{"capacity":10}`},
+		{"POST", "/table_groups", `{"name":"terrace", "table_ids":[2, 3]}`},
+		{"POST", "/guest_list/Kim", `{"accompanying_guests":3, "table_group_id":1, "diet":"vegan"}`},
+		{"POST", "/guest_list/Kim/members", `{"name":"Lee", "gluten_free":true}`},
+		{"POST", "/guest_list/Kim/members", `{"name":"Max", "nut_allergy":true}`},
+		{"PUT", "/guest_list/Kim/seats", `{"assignments":[{"table_id":3, "position":1, "guest":0}]}`},
+	}
+	for _, step := range steps {
+		req, _ := http.NewRequest(step.method, step.url, bytes.NewBuffer([]byte(step.args)))
+		req.Header.Set("Content-Type", "application/json")
+		if response := executeRequest(req); response.Code >= 300 {
+			t.Fatalf("%s %s failed with %d: %s", step.method, step.url, response.Code, response.Body.String())
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/catering_report", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var report models.CateringReport
+	json.Unmarshal(response.Body.Bytes(), &report)
+	// Kim sits on the seat assigned at table 3, the members of the party on
+	// the other seats it holds, at table 2.
+	want := []models.TableCatering{
+		{TableId: 1, CateringCounts: models.CateringCounts{Vegetarian: 1, Vegan: 1, GlutenFree: 1, NutAllergy: 1}},
+		{TableId: 2, CateringCounts: models.CateringCounts{GlutenFree: 1, NutAllergy: 1}},
+		{TableId: 3, CateringCounts: models.CateringCounts{Vegan: 1}},
+	}
+	if fmt.Sprint(report.Tables) != fmt.Sprint(want) {
+		t.Errorf("Expected the meals at the tables of the seats %+v. Got %+v", want, report.Tables)
+	}
+	total := models.CateringCounts{Vegetarian: 1, Vegan: 2, GlutenFree: 2, NutAllergy: 2}
+	if report.Total != total {
+		t.Errorf("Expected %+v in total, archived parties excluded. Got %+v", total, report.Total)
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/checkin"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newSigner(t *testing.T, key string) *checkin.Signer {
+	signer, err := checkin.NewSigner([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestCheckInSigner(t *testing.T) {
+	signer := newSigner(t, "secret")
+	token := signer.Sign(42)
+	if id, err := signer.Verify(token); err != nil || id != 42 {
+		t.Errorf("Expected reservation 42. Got %v, %v", id, err)
+	}
+	if _, err := newSigner(t, "other").Verify(token); err != checkin.ErrInvalidToken {
+		t.Errorf("Expected a token signed with another key to be refused. Got %v", err)
+	}
+	forged := "43" + token[strings.Index(token, "."):]
+	if _, err := signer.Verify(forged); err != checkin.ErrInvalidToken {
+		t.Errorf("Expected a token for another reservation to be refused. Got %v", err)
+	}
+}
+
+func TestCheckInWithToken(t *testing.T)  {
+	clearTable()
+	ensureTableExists()
+	defer func() {
+		clearTable()
+		ensureTableExists()
+	}()
+	if err := app.Handlers.SetCheckInKey([]byte("test-key")); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("POST", "/tables", bytes.NewBuffer([]byte(`{"capacity":10}`)))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("POST", "/guest_list/Max", bytes.NewBuffer([]byte(`{"accompanying_guests":2, "table_id":1}`)))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var guest models.GuestDto
+	json.Unmarshal(response.Body.Bytes(), &guest)
+	req, _ = http.NewRequest("POST", "/guest_list/Ana", bytes.NewBuffer([]byte(`{"accompanying_guests":1, "table_id":1}`)))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var arrived models.GuestDto
+	json.Unmarshal(response.Body.Bytes(), &arrived)
+	req, _ = http.NewRequest("PUT", "/guests/Ana", bytes.NewBuffer([]byte(`{"accompanying_guests":1}`)))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("GET", "/confirmations/"+guest.ConfirmationCode+"/qr.png", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if !bytes.HasPrefix(response.Body.Bytes(), []byte("\x89PNG")) {
+		t.Errorf("Expected a PNG image")
+	}
+
+	req, _ = http.NewRequest("GET", "/confirmations/"+guest.ConfirmationCode, nil)
+	var reservation models.GuestsReservation
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &reservation)
+	token := newSigner(t, "test-key").Sign(reservation.Id)
+	req, _ = http.NewRequest("GET", "/confirmations/"+arrived.ConfirmationCode, nil)
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &reservation)
+	arrivedToken := newSigner(t, "test-key").Sign(reservation.Id)
+
+	tests:= []struct{
+		name 		string
+		args 		string
+		want 		int
+	}{
+		{
+			name: "test if a forged token is refused",
+			args: `{"token":"` + newSigner(t, "guess").Sign(reservation.Id) + `"}`,
+			want: 403,
+		},
+		{
+			name: "test if the party checks in with its token",
+			args: `{"token":"` + token + `"}`,
+			want: 200,
+		},
+		{
+			name: "test if the token cannot be used twice",
+			args: `{"token":"` + token + `"}`,
+			want: 409,
+		},
+		{
+			name: "test if the token of a party that arrived by name is refused",
+			args: `{"token":"` + arrivedToken + `"}`,
+			want: 409,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/checkin", bytes.NewBuffer([]byte(tt.args)))
+			req.Header.Set("Content-Type", "application/json")
+
+			response := executeRequest(req)
+			checkResponseCode(t, tt.want, response.Code)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"github.com/getground/tech-tasks/backend/cmd/app/config"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T)  {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	env := func(vars map[string]string) func(string) (string, bool) {
+		return func(key string) (string, bool) {
+			v, ok := vars[key]
+			return v, ok
+		}
+	}
+	yamlFile := write("app.yaml", `
+listen: ":8080"
+db:
+  host: db.internal
+  port: 3307
+  user: app
+  name: guests
+  password_file: `+write("db_password", "from a file\n")+`
+features:
+  live: false
+auth:
+  api_keys:
+    - door-1:door:`+strings.Repeat("ab", 32)+`
+`)
+
+	t.Run("test if the file, the environment and the flags override each other in turn", func(t *testing.T) {
+		cfg, err := config.Load([]string{"-db.port", "3308"},
+			env(map[string]string{"CONFIG_FILE": yamlFile, "DB_HOST": "db.env", "DB_PORT": "3309", "DB_PASSWORD": ""}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Listen != ":8080" || cfg.DB.Host != "db.env" || cfg.DB.Port != 3308 || cfg.DB.User != "app" ||
+			cfg.DB.Password != "from a file" || cfg.Features.Live || !cfg.Features.Webhooks ||
+			cfg.ReminderLead != 24*time.Hour || !strings.HasPrefix(cfg.Auth.APIKeys, "door-1:door:") {
+			t.Errorf("Expected the layers to be merged. Got %+v", cfg)
+		}
+		if cfg.DB.DSN() != "app:from a file@tcp(db.env:3308)/guests" {
+			t.Errorf("Unexpected DSN %s", cfg.DB.DSN())
+		}
+	})
+
+	t.Run("test if a JSON file named by the flag is read", func(t *testing.T) {
+		jsonFile := write("app.json", `{"db": {"user": "json", "name": "guests"}, "event": {"start": "2026-06-01T18:00:00Z"}}`)
+		cfg, err := config.Load([]string{"-config", jsonFile}, env(map[string]string{"CONFIG_FILE": yamlFile}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.DB.User != "json" || cfg.DB.Port != 3306 || !cfg.Event.Start.Equal(time.Date(2026, 6, 1, 18, 0, 0, 0, time.UTC)) {
+			t.Errorf("Expected the JSON file to be read. Got %+v", cfg)
+		}
+	})
+
+	t.Run("test if secrets are read from files named in the environment", func(t *testing.T) {
+		cfg, err := config.Load(nil, env(map[string]string{"DB_USER": "app", "DB_NAME": "guests",
+			"JWT_SECRET_FILE": write("jwt", strings.Repeat("s", 40))}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Auth.JWTSecret != strings.Repeat("s", 40) {
+			t.Errorf("Expected the JWT secret from the file. Got %q", cfg.Auth.JWTSecret)
+		}
+	})
+
+	t.Run("test if every problem is reported at once", func(t *testing.T) {
+		_, err := config.Load([]string{"-db.max_idle_conns", "50"}, env(map[string]string{
+			"DB_PORT": "x", "JWT_SECRET": "short", "SMTP_ADDR": "mail:25", "FEATURE_LIVE": "maybe",
+			"API_KEYS": "ops:" + strings.Repeat("ab", 32), "CONFIG_FILE": write("typo.yaml", "db:\n  hots: x\n")}))
+		if err == nil {
+			t.Fatal("Expected the configuration to be refused")
+		}
+		for _, want := range []string{"DB_PORT", "db.user must be set", "db.name must be set", "db.max_idle_conns",
+			"auth.jwt_secret", "API key ops has no role", "smtp.from", "FEATURE_LIVE", "unknown setting db.hots"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("Expected %q to be reported. Got %v", want, err)
+			}
+		}
+	})
+
+	t.Run("test if the printed configuration has its secrets redacted", func(t *testing.T) {
+		cfg, err := config.Load([]string{"-smtp.password", "hunter2"}, env(map[string]string{"CONFIG_FILE": yamlFile}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var printed strings.Builder
+		cfg.Print(&printed)
+		out := printed.String()
+		if strings.Contains(out, "hunter2") || strings.Contains(out, "from a file") {
+			t.Errorf("Expected the secrets to be redacted. Got\n%s", out)
+		}
+		for _, want := range []string{"db.host = db.internal\n", "db.password = [redacted]\n",
+			"smtp.password = [redacted]\n", "auth.jwt_secret = \n", "features.live = false\n"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("Expected %q to be printed. Got\n%s", want, out)
+			}
+		}
+	})
+}
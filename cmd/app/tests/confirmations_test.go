@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestConfirmationCodes(t *testing.T)  {
+	clearTable()
+	ensureTableExists()
+	defer func() {
+		clearTable()
+		ensureTableExists()
+	}()
+
+	req, _ := http.NewRequest("POST", "/tables", bytes.NewBuffer([]byte(`{"capacity":10}`)))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("POST", "/guest_list/Lea", bytes.NewBuffer([]byte(`{"accompanying_guests":2, "table_id":1}`)))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var guest models.GuestDto
+	json.Unmarshal(response.Body.Bytes(), &guest)
+	if !regexp.MustCompile(`^[A-HJ-NP-Z2-9]{6}$`).MatchString(guest.ConfirmationCode) {
+		t.Fatalf("Expected a 6 character code without 0, O, 1 or I. Got %q", guest.ConfirmationCode)
+	}
+	typed := strings.ToLower(guest.ConfirmationCode[:3] + "-" + guest.ConfirmationCode[3:])
+
+	tests:= []struct{
+		name 		string
+		method 		string
+		url 		string
+		args 		string
+		want 		int
+	}{
+		{
+			name: "test if the reservation can be looked up by its code as typed by a guest",
+			method: "GET",
+			url: "/confirmations/" + typed,
+			want: 200,
+		},
+		{
+			name: "test if an unknown code is reported",
+			method: "GET",
+			url: "/confirmations/AAAAAA",
+			want: 404,
+		},
+		{
+			name: "test if the party can check in with the code",
+			method: "PUT",
+			url: "/confirmations/" + guest.ConfirmationCode + "/arrival",
+			args: `{"accompanying_guests":3}`,
+			want: 200,
+		},
+		{
+			name: "test if an arrived party cannot be cancelled",
+			method: "DELETE",
+			url: "/confirmations/" + guest.ConfirmationCode,
+			want: 409,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.url, bytes.NewBuffer([]byte(tt.args)))
+			req.Header.Set("Content-Type", "application/json")
+
+			response := executeRequest(req)
+			checkResponseCode(t, tt.want, response.Code)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository/database"
+	"net/http"
+	"testing"
+)
+
+// The schema of the first version, before table groups, seats and the rest.
+const createFirstTables = `CREATE TABLE tables
+(
+	id INT NOT NULL auto_increment,
+                         PRIMARY KEY (id),
+                         capacity int,
+                         booked_seats int,
+                         available_seats int
+)`
+
+const createFirstGuestList = `CREATE TABLE guestsList
+(
+	id INT NOT NULL auto_increment,
+                         PRIMARY KEY (id),
+                         table_id INT,
+                         name VARCHAR(100) NOT NULL,
+                         accompanying_guests INT,
+                         status int,
+                         arrival_time bigint,
+                         FOREIGN KEY (table_id) REFERENCES tables(id)
+)`
+
+func TestMigrate(t *testing.T)  {
+	clearTable()
+	defer func() {
+		clearTable()
+		ensureTableExists()
+	}()
+
+	for _, stmt := range []string{createFirstTables, createFirstGuestList,
+		"INSERT INTO tables(capacity, booked_seats, available_seats) VALUES (4, 3, 1)",
+		"INSERT INTO guestsList(table_id, name, accompanying_guests, status) VALUES (1, 'Olga', 3, 0)"} {
+		if _, err := app.DB.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := database.NewSQLGuestRepo(app.DB)
+	for i := 0; i < 2; i++ {
+		if err := repo.Migrate(context.Background()); err != nil {
+			t.Fatalf("Expected migration %d to succeed. Got %v", i+1, err)
+		}
+	}
+	if backfilled, err := repo.BackfillSeats(context.Background()); err != nil || backfilled != 1 {
+		t.Fatalf("Expected 1 table to be backfilled. Got %d, %v", backfilled, err)
+	}
+
+	req, _ := http.NewRequest("GET", "/tables/1/seats", nil)
+	var seats models.SeatList
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &seats)
+	booked := 0
+	for _, seat := range seats.Seats {
+		if seat.ReservationId != 0 {
+			booked++
+		}
+	}
+	if len(seats.Seats) != 4 || booked != 3 {
+		t.Errorf("Expected 4 seats with 3 booked. Got %d with %d booked", len(seats.Seats), booked)
+	}
+
+	// The party from before the upgrade can check in and be found by its new
+	// confirmation code.
+	req, _ = http.NewRequest("PUT", "/guests/Olga", bytes.NewBuffer([]byte(`{"accompanying_guests":4}`)))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("GET", "/seats_empty", nil)
+	var m map[string]interface{}
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &m)
+	if m["seats_empty"] != float64(0) {
+		t.Errorf("Expected the table to be full. Got %v empty", m["seats_empty"])
+	}
+	var code string
+	if err := app.DB.QueryRow("SELECT confirmation_code FROM guestsList WHERE name = 'Olga'").Scan(&code); err != nil {
+		t.Fatal(err)
+	}
+	req, _ = http.NewRequest("GET", "/confirmations/"+code, nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExportGuestsList(t *testing.T)  {
+	clearTable()
+	ensureTableExists()
+	defer func() {
+		clearTable()
+		ensureTableExists()
+	}()
+
+	steps:= []struct{
+		method 		string
+		url 		string
+		args 		string
+	}{
+		{"POST", "/tables", `{"capacity":10}`},
+		{"POST", "/guest_list/Zoe", `{"accompanying_guests":2, "table_id":1, "diet":"vegan"}`},
+		{"POST", "/guest_list/Abe", `{"accompanying_guests":3, "table_id":1}`},
+		{"PUT", "/guests/Abe", `{"accompanying_guests":3}`},
+	}
+	for _, step := range steps {
+		req, _ := http.NewRequest(step.method, step.url, bytes.NewBuffer([]byte(step.args)))
+		req.Header.Set("Content-Type", "application/json")
+		if response := executeRequest(req); response.Code >= 300 {
+			t.Fatalf("%s %s failed with %d: %s", step.method, step.url, response.Code, response.Body.String())
+		}
+	}
+
+	tests:= []struct{
+		name 		string
+		url 		string
+		accept 		string
+		contentType	string
+		want 		[]string
+	}{
+		{
+			name: "test if the list is sent as CSV",
+			url: "/guest_list",
+			accept: "text/csv",
+			contentType: "text/csv; charset=utf-8",
+			want: []string{"name", "Abe", "Zoe"},
+		},
+		{
+			name: "test if the list is sent as NDJSON",
+			url: "/guest_list",
+			accept: "application/x-ndjson",
+			contentType: "application/x-ndjson",
+			want: []string{"Abe", "Zoe"},
+		},
+		{
+			name: "test if the door list is sent as plain text",
+			url: "/guest_list?format=door",
+			contentType: "text/plain; charset=utf-8",
+			want: []string{"NAME", "Abe", "Zoe"},
+		},
+		{
+			name: "test if only arrived guests are exported",
+			url: "/guests",
+			accept: "text/plain;q=0.5, text/csv",
+			contentType: "text/csv; charset=utf-8",
+			want: []string{"name", "Abe"},
+		},
+		{
+			name: "test if JSON is still the default",
+			url: "/guests",
+			accept: "*/*",
+			contentType: "application/json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			response := executeRequest(req)
+			checkResponseCode(t, http.StatusOK, response.Code)
+			if got := response.Header().Get("Content-Type"); got != tt.contentType {
+				t.Fatalf("Expected content type %v. Got %v", tt.contentType, got)
+			}
+			if tt.want == nil {
+				return
+			}
+
+			lines := strings.Split(strings.TrimRight(response.Body.String(), "\n"), "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("Expected %v lines. Got %q", len(tt.want), lines)
+			}
+			for i, line := range lines {
+				var name string
+				switch tt.contentType {
+				case "application/x-ndjson":
+					var guest models.GuestsReservation
+					json.Unmarshal([]byte(line), &guest)
+					name = guest.Name
+				case "text/csv; charset=utf-8":
+					record, _ := csv.NewReader(strings.NewReader(line)).Read()
+					name = record[0]
+				default:
+					name = strings.Fields(line)[0]
+				}
+				if name != tt.want[i] {
+					t.Errorf("Expected %v on line %d. Got %q", tt.want[i], i, line)
+				}
+			}
+		})
+	}
+}
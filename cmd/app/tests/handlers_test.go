@@ -245,6 +245,11 @@ func TestGuestLeaves(t *testing.T)  {
 			want: 204,
 			guestName: "Tom",
 		},
+		{
+			name: "test if a party that left cannot leave again",
+			want: 409,
+			guestName: "Tom",
+		},
 		{
 			name: "test if the reservation couldn't be archived because of invalid name",
 			want: 500,
@@ -266,6 +271,10 @@ func TestGuestLeaves(t *testing.T)  {
 			}
 		})
 	}
+
+	// A party that left is not checked in again on seats it gave back.
+	req, _ := http.NewRequest("PUT", "/guests/Tom", bytes.NewBuffer([]byte(`{"accompanying_guests":2}`)))
+	checkResponseCode(t, http.StatusConflict, executeRequest(req).Code)
 }
 
 func executeRequest(req *http.Request) *httptest.ResponseRecorder {
@@ -281,24 +290,33 @@ func checkResponseCode(t *testing.T, expected, actual int) {
 }
 
 func ensureTableExists() {
-	if _, err := app.DB.Exec(createTableTables); err != nil {
-		log.Fatal(err)
-	}
-
-	if _, err := app.DB.Exec(createTableGuestList); err != nil {
-		log.Fatal(err)
+	for _, stmt := range createSchema {
+		if _, err := app.DB.Exec(stmt); err != nil {
+			log.Fatal(err)
+		}
 	}
 }
 
 func clearTable() {
-	if _, err := app.DB.Exec("DROP TABLE IF EXISTS getground.guestsList"); err != nil {
-		log.Fatal(err)
-	}
-	if _, err := app.DB.Exec("DROP TABLE IF EXISTS getground.tables"); err != nil {
-		log.Fatal(err)
+	for i := len(schemaTables) - 1; i >= 0; i-- {
+		if _, err := app.DB.Exec("DROP TABLE IF EXISTS getground." + schemaTables[i]); err != nil {
+			log.Fatal(err)
+		}
 	}
 }
 
+// schemaTables lists the tables in creation order, so that dropping them in
+// reverse respects the foreign keys.
+var schemaTables = []string{"tables", "table_groups", "table_group_members", "guestsList", "reservation_tables", "seats",
+	"party_members", "audit_log", "audit_log_tables", "webhooks", "webhook_outbox", "webhook_deliveries",
+	"notifications"}
+
+var createSchema = []string{
+	createTableTables, createTableGroups, createTableGroupMembers, createTableGuestList, createTableReservationTables,
+	createTableSeats, createTablePartyMembers, createTableAuditLog, createTableAuditLogTables, createTableWebhooks,
+	createTableWebhookOutbox, createTableWebhookDeliveries, createTableNotifications,
+}
+
 const createTableTables = `CREATE TABLE IF NOT EXISTS tables
 (
 	id INT NOT NULL auto_increment, PRIMARY KEY (id),
@@ -307,17 +325,160 @@ const createTableTables = `CREATE TABLE IF NOT EXISTS tables
                           available_seats int
 )`
 
+const createTableGroups = `CREATE TABLE IF NOT EXISTS table_groups
+(
+	id INT NOT NULL auto_increment, PRIMARY KEY (id),
+                          name VARCHAR(100) NOT NULL
+)`
+
+const createTableGroupMembers = `CREATE TABLE IF NOT EXISTS table_group_members
+(
+	group_id INT NOT NULL,
+                          table_id INT NOT NULL,
+                          position int NOT NULL,
+                          PRIMARY KEY (group_id, table_id),
+                          FOREIGN KEY (group_id) REFERENCES table_groups(id),
+                          FOREIGN KEY (table_id) REFERENCES tables(id)
+)`
+
 const createTableGuestList = `CREATE TABLE IF NOT EXISTS guestsList
 (
 	id INT NOT NULL auto_increment,
                          PRIMARY KEY (id),
                          table_id INT,
+                         table_group_id INT NULL,
                          name VARCHAR(100) NOT NULL,
                          accompanying_guests INT,
                          status int,
                          arrival_time bigint,
+                         rsvp_token VARCHAR(64) NULL UNIQUE,
+                         invited BOOLEAN NOT NULL DEFAULT FALSE,
+                         confirmation_code CHAR(6) NULL UNIQUE,
+                         checkin_used_at bigint NULL,
+                         dietary_needs VARCHAR(255) NOT NULL DEFAULT '',
+                         diet VARCHAR(20) NOT NULL DEFAULT '',
+                         gluten_free BOOLEAN NOT NULL DEFAULT FALSE,
+                         nut_allergy BOOLEAN NOT NULL DEFAULT FALSE,
+                         email VARCHAR(255) NOT NULL DEFAULT '',
+                         FOREIGN KEY (table_id) REFERENCES tables(id),
+                         FOREIGN KEY (table_group_id) REFERENCES table_groups(id)
+)`
+
+const createTableReservationTables = `CREATE TABLE IF NOT EXISTS reservation_tables
+(
+	reservation_id INT NOT NULL,
+                         table_id INT NOT NULL,
+                         seats int NOT NULL,
+                         position int NOT NULL,
+                         PRIMARY KEY (reservation_id, table_id),
+                         FOREIGN KEY (reservation_id) REFERENCES guestsList(id),
                          FOREIGN KEY (table_id) REFERENCES tables(id)
 )`
 
+const createTableSeats = `CREATE TABLE IF NOT EXISTS seats
+(
+	id INT NOT NULL auto_increment,
+                         PRIMARY KEY (id),
+                         table_id INT NOT NULL,
+                         position int NOT NULL,
+                         reservation_id INT NULL,
+                         guest_index int NULL,
+                         UNIQUE (table_id, position),
+                         FOREIGN KEY (table_id) REFERENCES tables(id),
+                         FOREIGN KEY (reservation_id) REFERENCES guestsList(id)
+)`
+
+const createTablePartyMembers = `CREATE TABLE IF NOT EXISTS party_members
+(
+	id INT NOT NULL auto_increment,
+                         PRIMARY KEY (id),
+                         reservation_id INT NOT NULL,
+                         name VARCHAR(100) NOT NULL,
+                         dietary_needs VARCHAR(255) NOT NULL DEFAULT '',
+                         age_group VARCHAR(10) NOT NULL DEFAULT 'adult',
+                         accessibility VARCHAR(255) NOT NULL DEFAULT '',
+                         diet VARCHAR(20) NOT NULL DEFAULT '',
+                         gluten_free BOOLEAN NOT NULL DEFAULT FALSE,
+                         nut_allergy BOOLEAN NOT NULL DEFAULT FALSE,
+                         FOREIGN KEY (reservation_id) REFERENCES guestsList(id)
+)`
+
+const createTableAuditLog = `CREATE TABLE IF NOT EXISTS audit_log
+(
+	id INT NOT NULL auto_increment,
+                         PRIMARY KEY (id),
+                         occurred_at bigint NOT NULL,
+                         actor VARCHAR(100) NOT NULL,
+                         action VARCHAR(50) NOT NULL,
+                         reservation_id INT NULL,
+                         before_state TEXT NULL,
+                         after_state TEXT NULL,
+                         INDEX (reservation_id),
+                         INDEX (occurred_at)
+)`
+
+const createTableAuditLogTables = `CREATE TABLE IF NOT EXISTS audit_log_tables
+(
+	audit_id INT NOT NULL,
+                         table_id INT NOT NULL,
+                         PRIMARY KEY (audit_id, table_id),
+                         INDEX (table_id),
+                         FOREIGN KEY (audit_id) REFERENCES audit_log(id)
+)`
+
+const createTableWebhooks = `CREATE TABLE IF NOT EXISTS webhooks
+(
+	id INT NOT NULL auto_increment,
+                         PRIMARY KEY (id),
+                         url VARCHAR(2048) NOT NULL,
+                         event_type VARCHAR(50) NOT NULL,
+                         secret VARCHAR(100) NOT NULL,
+                         active BOOLEAN NOT NULL DEFAULT TRUE,
+                         INDEX (event_type)
+)`
+
+const createTableWebhookOutbox = `CREATE TABLE IF NOT EXISTS webhook_outbox
+(
+	id INT NOT NULL auto_increment,
+                         PRIMARY KEY (id),
+                         webhook_id INT NOT NULL,
+                         event_type VARCHAR(50) NOT NULL,
+                         payload TEXT NOT NULL,
+                         created_at bigint NOT NULL,
+                         attempts int NOT NULL DEFAULT 0,
+                         next_attempt_at bigint NULL,
+                         delivered_at bigint NULL,
+                         INDEX (next_attempt_at),
+                         FOREIGN KEY (webhook_id) REFERENCES webhooks(id)
+)`
 
+const createTableWebhookDeliveries = `CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+	id INT NOT NULL auto_increment,
+                         PRIMARY KEY (id),
+                         message_id INT NOT NULL,
+                         attempt int NOT NULL,
+                         attempted_at bigint NOT NULL,
+                         status_code int NOT NULL,
+                         error VARCHAR(255) NOT NULL DEFAULT '',
+                         duration_ms bigint NOT NULL,
+                         delivered BOOLEAN NOT NULL,
+                         FOREIGN KEY (message_id) REFERENCES webhook_outbox(id)
+)`
 
+const createTableNotifications = `CREATE TABLE IF NOT EXISTS notifications
+(
+	id INT NOT NULL auto_increment,
+                         PRIMARY KEY (id),
+                         reservation_id INT NOT NULL,
+                         kind VARCHAR(30) NOT NULL,
+                         recipient VARCHAR(255) NOT NULL,
+                         payload TEXT NOT NULL,
+                         created_at bigint NOT NULL,
+                         attempts int NOT NULL DEFAULT 0,
+                         next_attempt_at bigint NULL,
+                         sent_at bigint NULL,
+                         last_error VARCHAR(255) NOT NULL DEFAULT '',
+                         INDEX (reservation_id),
+                         INDEX (next_attempt_at)
+)`
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/getground/tech-tasks/backend/cmd/app/health"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyDB fails its pings while down, and the first failFirst of them.
+type flakyDB struct {
+	mu        sync.Mutex
+	down      bool
+	failFirst int
+	pings     int
+}
+
+func (f *flakyDB) PingContext(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pings++
+	if f.down || f.pings <= f.failFirst {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (f *flakyDB) setDown(down bool) {
+	f.mu.Lock()
+	f.down = down
+	f.mu.Unlock()
+}
+
+func TestDatabaseHealth(t *testing.T)  {
+	quick := health.Retry{Initial: time.Millisecond, Max: 4 * time.Millisecond}
+
+	t.Run("test if the retry delays double up to the maximum with jitter", func(t *testing.T) {
+		r := health.Retry{Initial: time.Second, Max: 30 * time.Second}
+		for _, tt := range []struct {
+			attempt int
+			max     time.Duration
+		}{{1, time.Second}, {2, 2 * time.Second}, {5, 16 * time.Second}, {6, 30 * time.Second}, {20, 30 * time.Second}} {
+			for i := 0; i < 20; i++ {
+				if d := r.Delay(tt.attempt); d < tt.max/2 || d > tt.max {
+					t.Errorf("Expected the delay of attempt %d between %v and %v. Got %v", tt.attempt, tt.max/2, tt.max, d)
+				}
+			}
+		}
+	})
+
+	t.Run("test if the database is waited for until it answers", func(t *testing.T) {
+		db := &flakyDB{failFirst: 3}
+		if err := health.Wait(context.Background(), db, quick); err != nil {
+			t.Fatal(err)
+		}
+		if db.pings != 4 {
+			t.Errorf("Expected 4 attempts. Got %d", db.pings)
+		}
+	})
+
+	t.Run("test if waiting gives up after the timeout", func(t *testing.T) {
+		r := quick
+		r.Timeout = 30 * time.Millisecond
+		if err := health.Wait(context.Background(), &flakyDB{down: true}, r); err == nil {
+			t.Errorf("Expected waiting to give up")
+		}
+	})
+
+	t.Run("test if readiness follows the database going away and coming back", func(t *testing.T) {
+		db := &flakyDB{}
+		checker := health.NewChecker(db, quick)
+		if checker.Ready() != health.ErrNotChecked {
+			t.Errorf("Expected not to be ready before the first check")
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go checker.Run(ctx, 10*time.Millisecond)
+
+		eventually := func(ready bool) {
+			deadline := time.Now().Add(2 * time.Second)
+			for (checker.Ready() == nil) != ready {
+				if time.Now().After(deadline) {
+					t.Fatalf("Expected ready to become %v", ready)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		}
+		eventually(true)
+		db.setDown(true)
+		eventually(false)
+		db.setDown(false)
+		eventually(true)
+	})
+
+	t.Run("test if the API reports itself ready", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/ready", nil)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var readiness map[string]string
+		json.Unmarshal(response.Body.Bytes(), &readiness)
+		if readiness["status"] != "ready" {
+			t.Errorf("Expected ready. Got %s", response.Body.String())
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/guestcsv"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseGuestsCSV(t *testing.T) {
+	file := "name,table_id,accompanying_guests,diet\n" +
+		"Nia,1,2,vegan\n" +
+		",,,\n" +
+		",1,2,\n" +
+		"Otto,x,1,\n" +
+		"nia,1,1,\n"
+	rows, rowErrors, err := guestcsv.Parse(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[0].Diet != models.Vegan || rows[0].Row != 2 {
+		t.Errorf("Expected 4 rows starting with Nia on row 2. Got %+v", rows)
+	}
+	wantRows := []int{4, 5, 6}
+	if len(rowErrors) != len(wantRows) {
+		t.Fatalf("Expected errors on rows %v. Got %+v", wantRows, rowErrors)
+	}
+	for i, e := range rowErrors {
+		if e.Row != wantRows[i] {
+			t.Errorf("Expected error %d on row %d. Got %+v", i, wantRows[i], e)
+		}
+	}
+
+	_, rowErrors, _ = guestcsv.Parse(strings.NewReader("name,accompanying_guests\nNia,2\n"))
+	if len(rowErrors) != 1 || rowErrors[0].Row != 1 {
+		t.Errorf("Expected the missing table column to be reported. Got %+v", rowErrors)
+	}
+}
+
+func TestImportGuestsList(t *testing.T)  {
+	tests:= []struct{
+		name 		string
+		file 		string
+		want 		int
+		wantedSeats	int
+	}{
+		{
+			name: "test if nothing is imported when a row is invalid",
+			file: "name,table_id,accompanying_guests\nNia,1,2\nOtto,1,-1\n",
+			want: 422,
+			wantedSeats: 10,
+		},
+		{
+			name: "test if nothing is imported when the table is too small",
+			file: "name,table_id,accompanying_guests\nNia,1,6\nOtto,1,6\n",
+			want: 422,
+			wantedSeats: 10,
+		},
+		{
+			name: "test if the whole list is imported",
+			file: "name,table_id,accompanying_guests\nNia,1,4\nOtto,1,6\n",
+			want: 200,
+			wantedSeats: 0,
+		},
+		{
+			name: "test if a list cannot be imported twice",
+			file: "name,table_id,accompanying_guests\nNia,1,4\n",
+			want: 422,
+			wantedSeats: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/imports/guest_list", bytes.NewBuffer([]byte(tt.file)))
+			req.Header.Set("Content-Type", "text/csv")
+
+			response := executeRequest(req)
+			checkResponseCode(t, tt.want, response.Code)
+
+			req, _ = http.NewRequest("GET", "/seats_empty", nil)
+			var m map[string]interface{}
+			json.Unmarshal(executeRequest(req).Body.Bytes(), &m)
+			if m["seats_empty"] != float64(tt.wantedSeats) {
+				t.Errorf("Expected %v empty seats. Got %v", tt.wantedSeats, m["seats_empty"])
+			}
+		})
+	}
+
+	for _, name := range []string{"Nia", "Otto"} {
+		req, _ := http.NewRequest("DELETE", "/guests/"+name, nil)
+		checkResponseCode(t, http.StatusNoContent, executeRequest(req).Code)
+	}
+}
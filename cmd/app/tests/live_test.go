@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	id, event, data string
+}
+
+func TestLiveUpdates(t *testing.T)  {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := app.Live.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	open := func(lastEventId string) (func() sseEvent, func()) {
+		streamCtx, stop := context.WithCancel(ctx)
+		req, _ := http.NewRequest("GET", server.URL+"/live", nil)
+		req = req.WithContext(streamCtx)
+		if lastEventId != "" {
+			req.Header.Set("Last-Event-ID", lastEventId)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("Expected an event stream. Got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		reader := bufio.NewReader(resp.Body)
+		next := func() sseEvent {
+			var e sseEvent
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					t.Fatalf("Expected another event. Got %v", err)
+				}
+				line = strings.TrimRight(line, "\n")
+				switch {
+				case line == "" && e.event != "":
+					return e
+				case strings.HasPrefix(line, "id: "):
+					e.id = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "event: "):
+					e.event = strings.TrimPrefix(line, "event: ")
+				case strings.HasPrefix(line, "data: "):
+					e.data = strings.TrimPrefix(line, "data: ")
+				}
+			}
+		}
+		return next, func() {
+			stop()
+			resp.Body.Close()
+		}
+	}
+	run := func(method, url, body string, want int) {
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer([]byte(body)))
+		checkResponseCode(t, want, executeRequest(req).Code)
+	}
+	expectSeats := func(e sseEvent) int32 {
+		var seats models.Seats
+		if e.event != "seats" || json.Unmarshal([]byte(e.data), &seats) != nil {
+			t.Fatalf("Expected the seat count. Got %+v", e)
+		}
+		return seats.SeatsEmpty
+	}
+	expectUpdate := func(e sseEvent, action string, status models.Status) {
+		var update struct {
+			Reservation struct {
+				Name   string        `json:"name"`
+				Status models.Status `json:"status"`
+			} `json:"reservation"`
+		}
+		if e.event != action || e.id == "" || json.Unmarshal([]byte(e.data), &update) != nil {
+			t.Fatalf("Expected a %s event. Got %+v", action, e)
+		}
+		if update.Reservation.Name != "Una" || update.Reservation.Status != status {
+			t.Errorf("Expected Una to have status %d. Got %+v", status, update.Reservation)
+		}
+	}
+
+	next, stop := open("")
+	empty := expectSeats(next())
+
+	run("POST", "/guest_list/Una", `{"accompanying_guests":2, "table_id":1}`, http.StatusOK)
+	created := next()
+	expectUpdate(created, models.AuditReservationCreated, models.Upcoming)
+	if seats := expectSeats(next()); seats != empty-2 {
+		t.Errorf("Expected %d empty seats after the booking. Got %d", empty-2, seats)
+	}
+
+	run("PUT", "/guests/Una", `{"accompanying_guests":2}`, http.StatusOK)
+	arrived := next()
+	expectUpdate(arrived, models.AuditArrived, models.Attended)
+	expectSeats(next())
+	stop()
+
+	// A client reconnecting after the booking gets the arrival it missed.
+	next, stop = open(created.id)
+	defer stop()
+	if missed := next(); missed.id != arrived.id || missed.event != models.AuditArrived {
+		t.Errorf("Expected the arrival to be replayed. Got %+v", missed)
+	}
+	expectSeats(next())
+
+	run("DELETE", "/guests/Una", "", http.StatusNoContent)
+	expectUpdate(next(), models.AuditLeft, models.Archived)
+	if seats := expectSeats(next()); seats != empty {
+		t.Errorf("Expected %d empty seats after leaving. Got %d", empty, seats)
+	}
+
+	req, _ := http.NewRequest("GET", "/live", nil)
+	req.Header.Set("Last-Event-ID", "x")
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+}
@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/notify"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository/database"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpStandIn is a minimal SMTP server keeping the messages it receives. It
+// refuses the recipient of the first reject messages.
+type smtpStandIn struct {
+	listener net.Listener
+	mu       sync.Mutex
+	reject   int
+	messages []string
+}
+
+func newSMTPStandIn(t *testing.T, reject int) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{listener: listener, reject: reject}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch command := strings.ToUpper(strings.Fields(line + " x")[0]); command {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "RCPT":
+			s.mu.Lock()
+			refused := s.reject > 0
+			s.reject--
+			s.mu.Unlock()
+			if refused {
+				reply("451 try again later")
+			} else {
+				reply("250 OK")
+			}
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpStandIn) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+func TestNotifications(t *testing.T)  {
+	standIn := newSMTPStandIn(t, 1)
+	defer standIn.listener.Close()
+	repo := database.NewSQLGuestRepo(app.DB)
+	smtp := notify.NewSMTP(standIn.listener.Addr().String(), "events@example.com", "", "")
+	event := models.Event{Name: "Summer Party", Start: time.Now().Add(time.Hour)}
+
+	run := func(method, url, body string, want int) *bytes.Buffer {
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer([]byte(body)))
+		response := executeRequest(req)
+		checkResponseCode(t, want, response.Code)
+		return response.Body
+	}
+	sendDue := func(sender *notify.Sender, want int) {
+		sent, err := sender.SendDue(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sent != want {
+			t.Errorf("Expected %d notifications to be sent. Got %d", want, sent)
+		}
+	}
+	notifications := func() []models.Notification {
+		var list models.NotificationList
+		json.Unmarshal(run("GET", "/notifications", "", http.StatusOK).Bytes(), &list)
+		return list.Notifications
+	}
+
+	run("POST", "/guest_list/Vi", `{"accompanying_guests":2, "table_id":1, "email":"not an address"}`,
+		http.StatusBadRequest)
+	var guest models.GuestDto
+	json.Unmarshal(run("POST", "/guest_list/Vi", `{"accompanying_guests":2, "table_id":1, "email":"vi@example.com"}`,
+		http.StatusOK).Bytes(), &guest)
+	defer run("DELETE", "/guests/Vi", "", http.StatusNoContent)
+
+	// The first attempt is refused and the confirmation waits for a retry.
+	sender := notify.NewSender(repo, smtp, event, 0)
+	sendDue(sender, 0)
+	list := notifications()
+	if len(list) != 1 || list[0].Kind != models.NotifyBookingConfirmed || list[0].Recipient != "vi@example.com" ||
+		list[0].Status != "pending" || list[0].Attempts != 1 || list[0].LastError == "" {
+		t.Fatalf("Expected a pending confirmation after one failed attempt. Got %+v", list)
+	}
+	sendDue(sender, 0)
+
+	app.DB.Exec("UPDATE notifications SET next_attempt_at = 0 WHERE sent_at IS NULL")
+	sendDue(sender, 1)
+	messages := standIn.received()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message to arrive. Got %d", len(messages))
+	}
+	for _, want := range []string{"To: vi@example.com", "Subject: Your booking for Summer Party is confirmed",
+		"2 seats at table 1", guest.ConfirmationCode} {
+		if !strings.Contains(messages[0], want) {
+			t.Errorf("Expected the confirmation to contain %q. Got %q", want, messages[0])
+		}
+	}
+
+	// Within the reminder lead every booked guest is reminded once.
+	reminding := notify.NewSender(repo, smtp, event, 24*time.Hour)
+	sendDue(reminding, 1)
+	sendDue(reminding, 0)
+	messages = standIn.received()
+	if len(messages) != 2 || !strings.Contains(messages[1], "Subject: Reminder: Summer Party") {
+		t.Errorf("Expected a reminder to arrive. Got %q", messages)
+	}
+
+	list = notifications()
+	if len(list) != 2 || list[0].Status != "sent" || list[0].Attempts != 2 || list[1].Kind != models.NotifyReminder ||
+		list[1].Status != "sent" {
+		t.Errorf("Expected the confirmation and the reminder to be logged as sent. Got %+v", list)
+	}
+	run("GET", "/notifications?reservation_id=x", "", http.StatusBadRequest)
+}
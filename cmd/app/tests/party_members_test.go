@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestPartyMembers(t *testing.T)  {
+	tests:= []struct{
+		name 		string
+		method 		string
+		url 		string
+		args 		string
+		want 		int
+	}{
+		{
+			name: "book a party of two",
+			method: "POST",
+			url: "/guest_list/Carol",
+			args: `{"accompanying_guests":2, "table_id":1}`,
+			want: 200,
+		},
+		{
+			name: "test if a member fills the place booked beside the main guest",
+			method: "POST",
+			url: "/guest_list/Carol/members",
+			args: `{"name":"Dan", "dietary_needs":"vegan"}`,
+			want: 200,
+		},
+		{
+			name: "test if an invalid age group is refused",
+			method: "POST",
+			url: "/guest_list/Carol/members",
+			args: `{"name":"Eve", "age_group":"teen"}`,
+			want: 400,
+		},
+		{
+			name: "test if a second member grows the party",
+			method: "POST",
+			url: "/guest_list/Carol/members",
+			args: `{"name":"Eve", "age_group":"child"}`,
+			want: 200,
+		},
+		{
+			name: "test if a third member grows it again",
+			method: "POST",
+			url: "/guest_list/Carol/members",
+			args: `{"name":"Fay", "accessibility":"wheelchair"}`,
+			want: 200,
+		},
+		{
+			name: "test if the party cannot shrink below the roster",
+			method: "PUT",
+			url: "/guests/Carol",
+			args: `{"accompanying_guests":3}`,
+			want: 409,
+		},
+		{
+			name: "test if a member can be edited",
+			method: "PUT",
+			url: "/guest_list/Carol/members/1",
+			args: `{"name":"Dan", "dietary_needs":"vegetarian"}`,
+			want: 200,
+		},
+		{
+			name: "test if a missing member is reported",
+			method: "PUT",
+			url: "/guest_list/Carol/members/99",
+			args: `{"name":"Dan"}`,
+			want: 404,
+		},
+		{
+			name: "test if a member can be removed",
+			method: "DELETE",
+			url: "/guest_list/Carol/members/3",
+			want: 204,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.url, bytes.NewBuffer([]byte(tt.args)))
+			req.Header.Set("Content-Type", "application/json")
+
+			response := executeRequest(req)
+			checkResponseCode(t, tt.want, response.Code)
+		})
+	}
+
+	req, _ := http.NewRequest("GET", "/seats_empty", nil)
+	response := executeRequest(req)
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["seats_empty"] != float64(7) {
+		t.Errorf("Expected the main guest and two members to hold 3 seats. Got %v empty", m["seats_empty"])
+	}
+
+	req, _ = http.NewRequest("DELETE", "/guests/Carol", nil)
+	checkResponseCode(t, http.StatusNoContent, executeRequest(req).Code)
+}
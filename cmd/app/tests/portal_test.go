@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"testing"
+)
+
+func TestPortal(t *testing.T)  {
+	req, _ := http.NewRequest("POST", "/guest_list/Kim", bytes.NewBuffer([]byte(`{"accompanying_guests":2, "table_id":1}`)))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var guest models.GuestDto
+	json.Unmarshal(response.Body.Bytes(), &guest)
+	if guest.RsvpToken == "" {
+		t.Fatalf("Expected a reservation token. Got %s", response.Body.String())
+	}
+
+	tests:= []struct{
+		name 		string
+		method 		string
+		url 		string
+		args 		string
+		want 		int
+	}{
+		{
+			name: "test if the guest can see their reservation",
+			method: "GET",
+			url: "/portal/" + guest.RsvpToken,
+			want: 200,
+		},
+		{
+			name: "test if an unknown token sees nothing",
+			method: "GET",
+			url: "/portal/unknown",
+			want: 404,
+		},
+		{
+			name: "test if the party cannot outgrow the table",
+			method: "PUT",
+			url: "/portal/" + guest.RsvpToken,
+			args: `{"accompanying_guests":20}`,
+			want: 409,
+		},
+		{
+			name: "test if the party can grow within the table",
+			method: "PUT",
+			url: "/portal/" + guest.RsvpToken,
+			args: `{"accompanying_guests":3}`,
+			want: 200,
+		},
+		{
+			name: "test if dietary notes can be added",
+			method: "PUT",
+			url: "/portal/" + guest.RsvpToken + "/dietary",
+			args: `{"diet":"vegan", "dietary_needs":"no mushrooms"}`,
+			want: 200,
+		},
+		{
+			name: "test if the guest can cancel",
+			method: "DELETE",
+			url: "/portal/" + guest.RsvpToken,
+			want: 204,
+		},
+		{
+			name: "test if a cancelled reservation cannot be cancelled again",
+			method: "DELETE",
+			url: "/portal/" + guest.RsvpToken,
+			want: 409,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.url, bytes.NewBuffer([]byte(tt.args)))
+			req.Header.Set("Content-Type", "application/json")
+
+			response := executeRequest(req)
+			checkResponseCode(t, tt.want, response.Code)
+		})
+	}
+
+	req, _ = http.NewRequest("GET", "/seats_empty", nil)
+	var m map[string]interface{}
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &m)
+	if m["seats_empty"] != float64(10) {
+		t.Errorf("Expected the cancelled seats back. Got %v empty", m["seats_empty"])
+	}
+}
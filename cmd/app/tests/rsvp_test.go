@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"testing"
+)
+
+func TestRsvp(t *testing.T)  {
+	for _, args := range []string{`{"accompanying_guests":2}`, `{"accompanying_guests":0, "table_id":1}`} {
+		req, _ := http.NewRequest("POST", "/invitations/Jo", bytes.NewBuffer([]byte(args)))
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+	}
+	req, _ := http.NewRequest("POST", "/invitations/Jo", bytes.NewBuffer([]byte(`{"accompanying_guests":2, "table_id":1}`)))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var invitation models.GuestsReservation
+	json.Unmarshal(response.Body.Bytes(), &invitation)
+	if invitation.RsvpToken == "" {
+		t.Fatalf("Expected an rsvp token. Got %s", response.Body.String())
+	}
+
+	tests:= []struct{
+		name 		string
+		method 		string
+		url 		string
+		args 		string
+		want 		int
+		wantedSeats	int
+	}{
+		{
+			name: "test if an invitation books no seats",
+			method: "GET",
+			url: "/rsvp/" + invitation.RsvpToken,
+			want: 200,
+			wantedSeats: 10,
+		},
+		{
+			name: "test if an unknown token is refused",
+			method: "POST",
+			url: "/rsvp/unknown/accept",
+			want: 404,
+			wantedSeats: 10,
+		},
+		{
+			name: "test if an empty party is refused",
+			method: "POST",
+			url: "/rsvp/" + invitation.RsvpToken + "/accept",
+			args: `{"accompanying_guests":0}`,
+			want: 400,
+			wantedSeats: 10,
+		},
+		{
+			name: "test if accepting books the seats at the table of the invitation",
+			method: "POST",
+			url: "/rsvp/" + invitation.RsvpToken + "/accept",
+			args: `{"accompanying_guests":2, "table_id":99}`,
+			want: 200,
+			wantedSeats: 8,
+		},
+		{
+			name: "test if an accepted invitation cannot be accepted twice",
+			method: "POST",
+			url: "/rsvp/" + invitation.RsvpToken + "/accept",
+			want: 409,
+			wantedSeats: 8,
+		},
+		{
+			name: "test if a party larger than the table is refused",
+			method: "PUT",
+			url: "/rsvp/" + invitation.RsvpToken,
+			args: `{"accompanying_guests":20}`,
+			want: 409,
+			wantedSeats: 8,
+		},
+		{
+			name: "test if a plus-one can be added",
+			method: "PUT",
+			url: "/rsvp/" + invitation.RsvpToken,
+			args: `{"accompanying_guests":3}`,
+			want: 204,
+			wantedSeats: 7,
+		},
+		{
+			name: "test if declining gives the seats back",
+			method: "POST",
+			url: "/rsvp/" + invitation.RsvpToken + "/decline",
+			want: 204,
+			wantedSeats: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.url, bytes.NewBuffer([]byte(tt.args)))
+			req.Header.Set("Content-Type", "application/json")
+
+			response := executeRequest(req)
+			checkResponseCode(t, tt.want, response.Code)
+
+			req, _ = http.NewRequest("GET", "/seats_empty", nil)
+			var m map[string]interface{}
+			json.Unmarshal(executeRequest(req).Body.Bytes(), &m)
+			if m["seats_empty"] != float64(tt.wantedSeats) {
+				t.Errorf("Expected %v empty seats. Got %v", tt.wantedSeats, m["seats_empty"])
+			}
+
+			// The invitation stays listed whether it is open, accepted or declined.
+			req, _ = http.NewRequest("GET", "/invitations", nil)
+			var invitations models.GuestList
+			json.Unmarshal(executeRequest(req).Body.Bytes(), &invitations)
+			listed := false
+			for _, g := range invitations.Guests {
+				listed = listed || g.Id == invitation.Id
+			}
+			if !listed {
+				t.Errorf("Expected the invitation to be listed")
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"github.com/getground/tech-tasks/backend/cmd/app/search"
+	"net/http"
+	"testing"
+)
+
+func TestSearchNormalise(t *testing.T) {
+	for _, name := range []string{"tom smith", "Tom  Smith", "Tóm Smith", " TOM\tsmith "} {
+		if got := search.Normalise(name); got != "tom smith" {
+			t.Errorf("Normalise(%q) = %q, want %q", name, got, "tom smith")
+		}
+	}
+}
+
+func TestSearchRank(t *testing.T) {
+	names := []string{"Tom Smith", "Thomas Smithers", "Anna Tomlinson", "Zoë Brown"}
+	tests:= []struct{
+		name 		string
+		query 		string
+		want 		string
+	}{
+		{
+			name: "test if diacritics and case are ignored",
+			query: "tóm SMITH",
+			want: "Tom Smith",
+		},
+		{
+			name: "test if surname first is found",
+			query: "Smith Tom",
+			want: "Tom Smith",
+		},
+		{
+			name: "test if a prefix is found",
+			query: "thom smi",
+			want: "Thomas Smithers",
+		},
+		{
+			name: "test if a typo is forgiven",
+			query: "Tom Smiht",
+			want: "Tom Smith",
+		},
+		{
+			name: "test if a surname alone is found",
+			query: "brown",
+			want: "Zoë Brown",
+		},
+		{
+			name: "test if a name without diacritics is found",
+			query: "zoe brown",
+			want: "Zoë Brown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := search.Rank(tt.query, names, 3)
+			if len(matches) == 0 || names[matches[0].Index] != tt.want {
+				t.Errorf("Expected %q first for %q. Got %v", tt.want, tt.query, matches)
+			}
+		})
+	}
+
+	if matches := search.Rank("Xavier", names, 3); len(matches) != 0 {
+		t.Errorf("Expected no match for an unrelated name. Got %v", matches)
+	}
+}
+
+func TestSearchGuests(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/guest_list/search", nil)
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("GET", "/guest_list/search?q=smith", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+}
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"testing"
+)
+
+func TestSeatCheck(t *testing.T)  {
+	check := func(method, url string, want int) models.SeatCheckReport {
+		req, _ := http.NewRequest(method, url, nil)
+		response := executeRequest(req)
+		checkResponseCode(t, want, response.Code)
+		var report models.SeatCheckReport
+		json.Unmarshal(response.Body.Bytes(), &report)
+		return report
+	}
+
+	req, _ := http.NewRequest("POST", "/guest_list/Quinn", bytes.NewBuffer([]byte(`{"accompanying_guests":3, "table_id":1}`)))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	defer func() {
+		req, _ := http.NewRequest("DELETE", "/guests/Quinn", nil)
+		checkResponseCode(t, http.StatusNoContent, executeRequest(req).Code)
+	}()
+
+	if report := check("GET", "/admin/seat_check", http.StatusOK); len(report.Discrepancies) != 0 {
+		t.Errorf("Expected no discrepancies. Got %+v", report.Discrepancies)
+	}
+
+	app.DB.Exec("UPDATE tables SET booked_seats = 0, available_seats = 4 WHERE id = 1")
+	report := check("GET", "/admin/seat_check", http.StatusOK)
+	want := map[string]models.SeatDiscrepancy{
+		"booked_seats": {TableId: 1, Field: "booked_seats", Expected: 3, Actual: 0},
+		"available_seats": {TableId: 1, Field: "available_seats", Expected: 7, Actual: 4},
+	}
+	for _, d := range report.Discrepancies {
+		if d != want[d.Field] {
+			t.Errorf("Unexpected discrepancy %+v", d)
+		}
+		delete(want, d.Field)
+	}
+	if len(want) > 0 {
+		t.Errorf("Expected discrepancies %+v to be reported. Got %+v", want, report.Discrepancies)
+	}
+	if report.Repaired {
+		t.Errorf("Expected the check not to repair anything")
+	}
+
+	if report := check("POST", "/admin/seat_check/repair", http.StatusOK); !report.Repaired || len(report.Discrepancies) != 2 {
+		t.Errorf("Expected the 2 discrepancies to be repaired. Got %+v", report)
+	}
+	if report := check("GET", "/admin/seat_check", http.StatusOK); len(report.Discrepancies) != 0 {
+		t.Errorf("Expected no discrepancies after the repair. Got %+v", report.Discrepancies)
+	}
+
+	req, _ = http.NewRequest("GET", "/seats_empty", nil)
+	var seats models.Seats
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &seats)
+	if seats.SeatsEmpty != 7 {
+		t.Errorf("Expected 7 empty seats after the repair. Got %v", seats.SeatsEmpty)
+	}
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"github.com/getground/tech-tasks/backend/cmd/app/server"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdown(t *testing.T)  {
+	served := api.NewSerwer()
+	served.Init(os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"),
+		os.Getenv("DB_NAME"))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	done := make(chan error, 1)
+	go func() {
+		done <- served.Serve(ctx, l)
+	}()
+	url := "http://" + l.Addr().String() + "/live"
+
+	// openStream returns the body of a live stream once its first event arrived.
+	openStream := func() io.ReadCloser {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkResponseCode(t, http.StatusOK, resp.StatusCode)
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, "event: seats") {
+			t.Fatalf("Expected the stream to start with the empty seats. Got %q, %v", line, err)
+		}
+		return resp.Body
+	}
+	// ended reports whether the stream was over within a few seconds.
+	ended := func(body io.ReadCloser) bool {
+		finished := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, body)
+			close(finished)
+		}()
+		select {
+		case <-finished:
+			return true
+		case <-time.After(3 * time.Second):
+			body.Close()
+			return false
+		}
+	}
+
+	t.Run("test if a live stream ends by itself at its limit", func(t *testing.T) {
+		served.Handlers.SetStreamLimit(100 * time.Millisecond)
+		defer served.Handlers.SetStreamLimit(0)
+		if !ended(openStream()) {
+			t.Errorf("Expected the stream to end after its limit")
+		}
+	})
+
+	t.Run("test if a shutdown ends the live streams, returns and closes the database", func(t *testing.T) {
+		body := openStream()
+		stop()
+		if !ended(body) {
+			t.Errorf("Expected the stream to end on shutdown")
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Expected a clean shutdown. Got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected Serve to return after the shutdown")
+		}
+		if _, err := http.Get(url); err == nil {
+			t.Errorf("Expected no more connections to be taken")
+		}
+		if err := served.DB.Ping(); err == nil {
+			t.Errorf("Expected the database to be closed")
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/snapshot"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func validSnapshot() *models.Snapshot {
+	return &models.Snapshot{
+		Version: snapshot.Version,
+		Tables: []models.SnapshotTable{{
+			Table: models.Table{Id: 1, Capacity: 3, BookedSeats: 2, AvailableSeats: 1},
+			Seats: []models.SnapshotSeat{{Position: 1, ReservationId: 7}, {Position: 2, ReservationId: 7}, {Position: 3}},
+		}},
+		Reservations: []models.SnapshotReservation{{
+			Id: 7, Name: "Vic", TableId: 1, AccompanyingGuests: 2, Status: models.Upcoming,
+			Tables: []models.SeatAllocation{{TableId: 1, Seats: 2}},
+		}},
+	}
+}
+
+func TestValidateSnapshot(t *testing.T) {
+	tests:= []struct{
+		name 		string
+		change 		func(s *models.Snapshot)
+		want 		string
+	}{
+		{
+			name: "test if a consistent snapshot is accepted",
+			change: func(s *models.Snapshot) {},
+		},
+		{
+			name: "test if another version is refused",
+			change: func(s *models.Snapshot) { s.Version = 99 },
+			want: "unsupported snapshot version",
+		},
+		{
+			name: "test if a version 1 snapshot is still accepted",
+			change: func(s *models.Snapshot) { s.Version = 1 },
+		},
+		{
+			name: "test if counters must add up to the capacity",
+			change: func(s *models.Snapshot) { s.Tables[0].AvailableSeats = 2 },
+			want: "do not make the capacity",
+		},
+		{
+			name: "test if an over-capacity table is refused",
+			change: func(s *models.Snapshot) {
+				s.Tables[0].BookedSeats, s.Tables[0].AvailableSeats = 4, -1
+			},
+			want: "over a capacity",
+		},
+		{
+			name: "test if a party must hold the seats it booked",
+			change: func(s *models.Snapshot) { s.Reservations[0].AccompanyingGuests = 3 },
+			want: "holds 2 seats for a party of 3",
+		},
+		{
+			name: "test if an invalid email address is refused",
+			change: func(s *models.Snapshot) { s.Reservations[0].Email = "vic at home" },
+			want: "invalid email",
+		},
+		{
+			name: "test if seats of unknown reservations are refused",
+			change: func(s *models.Snapshot) { s.Tables[0].Seats[2].ReservationId = 8 },
+			want: "unknown reservation 8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := validSnapshot()
+			tt.change(s)
+			problems := snapshot.Validate(s)
+			if tt.want == "" {
+				if len(problems) > 0 {
+					t.Errorf("Expected no problems. Got %q", problems)
+				}
+				return
+			}
+			if !strings.Contains(strings.Join(problems, "\n"), tt.want) {
+				t.Errorf("Expected a problem containing %q. Got %q", tt.want, problems)
+			}
+		})
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T)  {
+	take := func() []byte {
+		req, _ := http.NewRequest("GET", "/admin/snapshot", nil)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		return response.Body.Bytes()
+	}
+	restore := func(mode string, body []byte) int {
+		req, _ := http.NewRequest("POST", "/admin/snapshot?mode="+mode, bytes.NewBuffer(body))
+		return executeRequest(req).Code
+	}
+	emptySeats := func() float64 {
+		req, _ := http.NewRequest("GET", "/seats_empty", nil)
+		var m map[string]interface{}
+		json.Unmarshal(executeRequest(req).Body.Bytes(), &m)
+		seats, _ := m["seats_empty"].(float64)
+		return seats
+	}
+
+	initial := take()
+	defer func() {
+		checkResponseCode(t, http.StatusOK, restore("replace", initial))
+	}()
+
+	req, _ := http.NewRequest("POST", "/guest_list/Sam", bytes.NewBuffer([]byte(`{"accompanying_guests":3, "table_id":1, "email":"sam@example.com"}`)))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	booked := take()
+	seatsBooked := emptySeats()
+
+	req, _ = http.NewRequest("DELETE", "/guests/Sam", nil)
+	checkResponseCode(t, http.StatusNoContent, executeRequest(req).Code)
+
+	var tampered models.Snapshot
+	json.Unmarshal(booked, &tampered)
+	tampered.Tables[0].BookedSeats++
+	body, _ := json.Marshal(tampered)
+	checkResponseCode(t, http.StatusUnprocessableEntity, restore("replace", body))
+	checkResponseCode(t, http.StatusBadRequest, restore("", booked))
+
+	checkResponseCode(t, http.StatusOK, restore("replace", booked))
+	if got := emptySeats(); got != seatsBooked {
+		t.Errorf("Expected %v empty seats after the restore. Got %v", seatsBooked, got)
+	}
+	checkResponseCode(t, http.StatusConflict, restore("merge", booked))
+
+	var restored models.Snapshot
+	json.Unmarshal(take(), &restored)
+	found := false
+	for _, r := range restored.Reservations {
+		if r.Name == "Sam" {
+			found = r.Status == models.Upcoming && r.ConfirmationCode != "" && r.Email == "sam@example.com"
+		}
+	}
+	if !found {
+		t.Errorf("Expected Sam to be booked again with their confirmation code and email. Got %+v",
+			restored.Reservations)
+	}
+}
+
+func TestUpgradeSnapshot(t *testing.T) {
+	s := validSnapshot()
+	s.Version = 1
+	s.Reservations = append(s.Reservations, models.SnapshotReservation{Id: 8, Name: "Ira", Status: models.Invited})
+	snapshot.Upgrade(s)
+	if s.Version != snapshot.Version || s.Reservations[0].Invited || !s.Reservations[1].Invited {
+		t.Errorf("Expected only the open invitation to be marked invited. Got %+v", s)
+	}
+}
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"net/http"
+	"testing"
+)
+
+func TestSyncGuestsList(t *testing.T)  {
+	tests:= []struct{
+		name 		string
+		url 		string
+		contentType	string
+		args 		string
+		want 		int
+		wantedDiff	[3]int
+		wantedSeats	int
+	}{
+		{
+			name: "test if a dry run only previews the changes",
+			url: "/sync/guest_list?dry_run=true",
+			contentType: "application/json",
+			args: `{"guests":[{"name":"Ada", "table_id":1, "accompanying_guests":3}, {"name":"Ben", "table_id":1, "accompanying_guests":2}]}`,
+			want: 200,
+			wantedDiff: [3]int{2, 0, 0},
+			wantedSeats: 10,
+		},
+		{
+			name: "test if the list is applied",
+			url: "/sync/guest_list",
+			contentType: "application/json",
+			args: `{"guests":[{"name":"Ada", "table_id":1, "accompanying_guests":3}, {"name":"Ben", "table_id":1, "accompanying_guests":2}]}`,
+			want: 200,
+			wantedDiff: [3]int{2, 0, 0},
+			wantedSeats: 5,
+		},
+		{
+			name: "test if nothing changes when the table is too small",
+			url: "/sync/guest_list",
+			contentType: "text/csv",
+			args: "name,table_id,accompanying_guests\nAda,1,4\nCy,1,7\n",
+			want: 422,
+			wantedSeats: 5,
+		},
+		{
+			name: "test if removed seats are reused by the same sync",
+			url: "/sync/guest_list",
+			contentType: "text/csv",
+			args: "name,table_id,accompanying_guests\nAda,1,4\nCy,1,6\n",
+			want: 200,
+			wantedDiff: [3]int{1, 1, 1},
+			wantedSeats: 0,
+		},
+		{
+			name: "test if an invalid list is refused",
+			url: "/sync/guest_list",
+			contentType: "application/json",
+			args: `{"guests":[{"name":"Ada", "table_id":1, "accompanying_guests":0}]}`,
+			want: 422,
+			wantedSeats: 0,
+		},
+		{
+			name: "test if an invalid email address is refused",
+			url: "/sync/guest_list",
+			contentType: "application/json",
+			args: `{"guests":[{"name":"Ada", "table_id":1, "accompanying_guests":4, "email":"ada at home"}]}`,
+			want: 422,
+			wantedSeats: 0,
+		},
+		{
+			name: "test if an empty list cancels everybody",
+			url: "/sync/guest_list",
+			contentType: "application/json",
+			args: `{"guests":[]}`,
+			want: 200,
+			wantedDiff: [3]int{0, 2, 0},
+			wantedSeats: 10,
+		},
+		{
+			name: "test if a cancelled guest can be added back",
+			url: "/sync/guest_list",
+			contentType: "application/json",
+			args: `{"guests":[{"name":"Ada", "table_id":1, "accompanying_guests":3}]}`,
+			want: 200,
+			wantedDiff: [3]int{1, 0, 0},
+			wantedSeats: 7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", tt.url, bytes.NewBuffer([]byte(tt.args)))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			response := executeRequest(req)
+			checkResponseCode(t, tt.want, response.Code)
+			if tt.want == http.StatusOK {
+				var result models.SyncResult
+				json.Unmarshal(response.Body.Bytes(), &result)
+				diff := [3]int{len(result.Added), len(result.Removed), len(result.Changed)}
+				if diff != tt.wantedDiff {
+					t.Errorf("Expected %v added, removed and changed. Got %+v", tt.wantedDiff, result)
+				}
+			}
+
+			req, _ = http.NewRequest("GET", "/seats_empty", nil)
+			var m map[string]interface{}
+			json.Unmarshal(executeRequest(req).Body.Bytes(), &m)
+			if m["seats_empty"] != float64(tt.wantedSeats) {
+				t.Errorf("Expected %v empty seats. Got %v", tt.wantedSeats, m["seats_empty"])
+			}
+		})
+	}
+
+	// The guest added back arrives and leaves as the new reservation, not the
+	// cancelled one.
+	req, _ := http.NewRequest("PUT", "/guests/Ada", bytes.NewBuffer([]byte(`{"accompanying_guests":3}`)))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("DELETE", "/guests/Ada", nil)
+	checkResponseCode(t, http.StatusNoContent, executeRequest(req).Code)
+}
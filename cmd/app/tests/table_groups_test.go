@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestTableGroups(t *testing.T)  {
+	tests:= []struct{
+		name 		string
+		method 		string
+		url 		string
+		args 		string
+		want 		int
+	}{
+		{
+			name: "add the first table of the group",
+			method: "POST",
+			url: "/tables",
+			args: `{"capacity":4}`,
+			want: 200,
+		},
+		{
+			name: "add the second table of the group",
+			method: "POST",
+			url: "/tables",
+			args: `{"capacity":4}`,
+			want: 200,
+		},
+		{
+			name: "test if a group needs at least two tables",
+			method: "POST",
+			url: "/table_groups",
+			args: `{"name":"window", "table_ids":[2]}`,
+			want: 400,
+		},
+		{
+			name: "test if the table group was added",
+			method: "POST",
+			url: "/table_groups",
+			args: `{"name":"window", "table_ids":[2, 3]}`,
+			want: 200,
+		},
+		{
+			name: "test if a party larger than one table spans the group",
+			method: "POST",
+			url: "/guest_list/Anna",
+			args: `{"accompanying_guests":6, "table_group_id":1}`,
+			want: 200,
+		},
+		{
+			name: "test if the group rejects a party larger than its free seats",
+			method: "POST",
+			url: "/guest_list/Ben",
+			args: `{"accompanying_guests":3, "table_group_id":1}`,
+			want: 500,
+		},
+		{
+			name: "test if the party can be moved to a single table",
+			method: "PUT",
+			url: "/guest_list/Anna/table",
+			args: `{"table_id":1}`,
+			want: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.url, bytes.NewBuffer([]byte(tt.args)))
+			req.Header.Set("Content-Type", "application/json")
+
+			response := executeRequest(req)
+			checkResponseCode(t, tt.want, response.Code)
+		})
+	}
+
+	req, _ := http.NewRequest("GET", "/seats_empty", nil)
+	response := executeRequest(req)
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["seats_empty"] != float64(12) {
+		t.Errorf("Expected 12 empty seats after the move. Got %v", m["seats_empty"])
+	}
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/repository/database"
+	"net/http"
+	"testing"
+)
+
+func TestAssignSeats(t *testing.T)  {
+	run := func(method, url, body string, want int) *bytes.Buffer {
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		response := executeRequest(req)
+		checkResponseCode(t, want, response.Code)
+		return response.Body
+	}
+	var table, other models.Table
+	json.Unmarshal(run("POST", "/tables", `{"capacity":10}`, http.StatusOK).Bytes(), &table)
+	json.Unmarshal(run("POST", "/tables", `{"capacity":4}`, http.StatusOK).Bytes(), &other)
+	run("POST", "/guest_list/Seda", fmt.Sprintf(`{"accompanying_guests":6, "table_id":%d}`, table.Id), http.StatusOK)
+
+	tests:= []struct{
+		name 		string
+		args 		string
+		want 		int
+	}{
+		{
+			name: "test if the main guest can take a free seat at the party's table",
+			args: fmt.Sprintf(`{"assignments":[{"table_id":%d, "position":10, "guest":0}]}`, table.Id),
+			want: 200,
+		},
+		{
+			name: "test if a seat at a table the party does not sit at is refused",
+			args: fmt.Sprintf(`{"assignments":[{"table_id":%d, "position":1, "guest":1}]}`, other.Id),
+			want: 500,
+		},
+		{
+			name: "test if a guest outside the party is refused",
+			args: fmt.Sprintf(`{"assignments":[{"table_id":%d, "position":9, "guest":7}]}`, table.Id),
+			want: 500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run("PUT", "/guest_list/Seda/seats", tt.args, tt.want)
+		})
+	}
+
+	var seats models.SeatList
+	json.Unmarshal(run("GET", fmt.Sprintf("/tables/%d/seats", table.Id), "", http.StatusOK).Bytes(), &seats)
+	booked := 0
+	for _, seat := range seats.Seats {
+		if seat.ReservationId != 0 {
+			booked++
+		}
+		if seat.Position == 10 && (seat.Guest == nil || *seat.Guest != 0) {
+			t.Errorf("Expected the main guest on seat 10. Got %v", seat.Guest)
+		}
+	}
+	if booked != 6 {
+		t.Errorf("Expected the party to still hold 6 seats. Got %v", booked)
+	}
+}
+
+func TestBackfillSeats(t *testing.T)  {
+	run := func(method, url, body string, want int) *bytes.Buffer {
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer([]byte(body)))
+		response := executeRequest(req)
+		checkResponseCode(t, want, response.Code)
+		return response.Body
+	}
+	repo := database.NewSQLGuestRepo(app.DB)
+	var table models.Table
+	json.Unmarshal(run("POST", "/tables", `{"capacity":5}`, http.StatusOK).Bytes(), &table)
+	run("POST", "/guest_list/Ode", fmt.Sprintf(`{"accompanying_guests":3, "table_id":%d}`, table.Id), http.StatusOK)
+	defer run("DELETE", "/guests/Ode", "", http.StatusNoContent)
+
+	// A table from before seats were modelled has its counters but no seats.
+	if _, err := app.DB.Exec("DELETE FROM seats WHERE table_id = ?", table.Id); err != nil {
+		t.Fatal(err)
+	}
+	backfilled, err := repo.BackfillSeats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backfilled != 1 {
+		t.Errorf("Expected 1 table to be backfilled. Got %d", backfilled)
+	}
+	var seats models.SeatList
+	json.Unmarshal(run("GET", fmt.Sprintf("/tables/%d/seats", table.Id), "", http.StatusOK).Bytes(), &seats)
+	booked := 0
+	for _, seat := range seats.Seats {
+		if seat.ReservationId != 0 {
+			booked++
+		}
+	}
+	if len(seats.Seats) != 5 || booked != 3 {
+		t.Errorf("Expected 5 seats with 3 booked. Got %d with %d booked", len(seats.Seats), booked)
+	}
+	if backfilled, err = repo.BackfillSeats(context.Background()); err != nil || backfilled != 0 {
+		t.Errorf("Expected nothing left to backfill. Got %d, %v", backfilled, err)
+	}
+}
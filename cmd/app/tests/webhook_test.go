@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"github.com/getground/tech-tasks/backend/cmd/app/webhook"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhooks(t *testing.T)  {
+	type received struct {
+		event, signature string
+		body             []byte
+	}
+	var calls []received
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		calls = append(calls, received{r.Header.Get("X-Webhook-Event"), r.Header.Get(webhook.SignatureHeader), body})
+		if len(calls) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	run := func(method, url, body string, want int) *bytes.Buffer {
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer([]byte(body)))
+		response := executeRequest(req)
+		checkResponseCode(t, want, response.Code)
+		return response.Body
+	}
+	deliver := func(want int) {
+		delivered, err := app.Webhooks.DeliverDue(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delivered != want {
+			t.Errorf("Expected %d delivered messages. Got %d", want, delivered)
+		}
+	}
+
+	run("POST", "/webhooks", `{"url":`, http.StatusBadRequest)
+	run("POST", "/webhooks", `{"url":"ftp://example.com","event_type":"reservation.arrived"}`, http.StatusBadRequest)
+	run("POST", "/webhooks", fmt.Sprintf(`{"url":%q,"event_type":"table.created"}`, receiver.URL), http.StatusBadRequest)
+
+	var hook models.Webhook
+	json.Unmarshal(run("POST", "/webhooks", fmt.Sprintf(`{"url":%q,"event_type":"reservation.arrived"}`, receiver.URL),
+		http.StatusOK).Bytes(), &hook)
+	if hook.Id == 0 || hook.Secret == "" {
+		t.Fatalf("Expected the new webhook with its secret. Got %+v", hook)
+	}
+	defer run("DELETE", fmt.Sprintf("/webhooks/%d", hook.Id), "", http.StatusNoContent)
+
+	var list models.WebhookList
+	json.Unmarshal(run("GET", "/webhooks", "", http.StatusOK).Bytes(), &list)
+	if len(list.Webhooks) != 1 || list.Webhooks[0].Secret != "" {
+		t.Errorf("Expected the webhook to be listed without its secret. Got %+v", list.Webhooks)
+	}
+
+	run("POST", "/guest_list/Wes", `{"accompanying_guests":1, "table_id":1}`, http.StatusOK)
+	run("PUT", "/guests/Wes", `{"accompanying_guests":1}`, http.StatusOK)
+	defer run("DELETE", "/guests/Wes", "", http.StatusNoContent)
+
+	deliver(0)
+	if len(calls) != 1 {
+		t.Fatalf("Expected only the arrival to be sent. Got %d calls", len(calls))
+	}
+	if calls[0].event != models.AuditArrived {
+		t.Errorf("Expected a %s event. Got %q", models.AuditArrived, calls[0].event)
+	}
+	if err := webhook.Verify(hook.Secret, calls[0].signature, calls[0].body, 0); err != nil {
+		t.Errorf("Expected a valid signature. Got %v", err)
+	}
+	if err := webhook.Verify("wrong", calls[0].signature, calls[0].body, 0); err == nil {
+		t.Errorf("Expected the signature not to verify with another secret")
+	}
+	var payload models.WebhookPayload
+	json.Unmarshal(calls[0].body, &payload)
+	if payload.Reservation.Name != "Wes" || payload.Reservation.Status != models.Attended {
+		t.Errorf("Expected Wes to have arrived in the payload. Got %+v", payload.Reservation)
+	}
+
+	// The failed message waits for its backoff before it is tried again.
+	deliver(0)
+	if len(calls) != 1 {
+		t.Errorf("Expected no retry before the backoff. Got %d calls", len(calls))
+	}
+	app.DB.Exec("UPDATE webhook_outbox SET next_attempt_at = 0 WHERE webhook_id = ? AND delivered_at IS NULL", hook.Id)
+	deliver(1)
+	if len(calls) != 2 || !bytes.Equal(calls[0].body, calls[1].body) {
+		t.Errorf("Expected the same payload to be sent again. Got %d calls", len(calls))
+	}
+	deliver(0)
+
+	var log models.WebhookDeliveryList
+	json.Unmarshal(run("GET", fmt.Sprintf("/webhooks/%d/deliveries", hook.Id), "", http.StatusOK).Bytes(), &log)
+	if len(log.Deliveries) != 2 {
+		t.Fatalf("Expected 2 attempts in the delivery log. Got %+v", log.Deliveries)
+	}
+	first, second := log.Deliveries[0], log.Deliveries[1]
+	if first.Attempt != 1 || first.StatusCode != http.StatusInternalServerError || first.Delivered || first.Error == "" {
+		t.Errorf("Expected the first attempt to have failed. Got %+v", first)
+	}
+	if second.Attempt != 2 || second.StatusCode != http.StatusOK || !second.Delivered {
+		t.Errorf("Expected the second attempt to be delivered. Got %+v", second)
+	}
+
+	run("GET", "/webhooks/999/deliveries", "", http.StatusNotFound)
+	run("DELETE", "/webhooks/999", "", http.StatusNotFound)
+}
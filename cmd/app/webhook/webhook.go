@@ -0,0 +1,206 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/getground/tech-tasks/backend/cmd/app/models"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	// MaxAttempts is how often a message is tried before it is given up.
+	MaxAttempts = 10
+	// lease keeps a claimed message from being claimed again while it is
+	// being delivered.
+	lease          = 5 * time.Minute
+	batchSize      = 20
+	maxErrorLength = 255
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the signature header of a payload sent at t. The signature is
+// HMAC-SHA256 over "<unix time>.<body>", so that a receiver can reject a
+// payload that was replayed long after it was sent.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac(secret, ts, body))
+}
+
+// Verify checks a signature header made by Sign. A signature older than
+// maxAge is rejected; zero accepts any age.
+func Verify(secret, header string, body []byte, maxAge time.Duration) error {
+	var ts, signature string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return ErrInvalidSignature
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			signature = kv[1]
+		}
+	}
+	sent, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, mac(secret, ts, body)) {
+		return ErrInvalidSignature
+	}
+	if maxAge > 0 && time.Since(time.Unix(sent, 0)) > maxAge {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func mac(secret, ts string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Backoff is how long to wait before the next attempt after the given failed
+// one: 30s, 1m, 2m and so on, at most an hour.
+func Backoff(attempt int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
+
+// Store is the outbox the Dispatcher delivers from.
+type Store interface {
+	ClaimWebhookMessages(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookMessage, error)
+	RecordWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery, attemptedAt, retryAt time.Time) error
+}
+
+// Dispatcher sends the messages waiting in the outbox to their webhooks.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+}
+
+func NewDispatcher(store Store) *Dispatcher {
+	return &Dispatcher{store: store, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Run delivers the due messages every interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.DeliverDue(ctx); err != nil {
+			log.Printf("webhook delivery failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue makes one attempt at every message that is due and returns how
+// many were delivered.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	delivered := 0
+	for {
+		messages, err := d.store.ClaimWebhookMessages(ctx, time.Now(), lease, batchSize)
+		if err != nil {
+			return delivered, err
+		}
+		for _, msg := range messages {
+			ok, err := d.deliver(ctx, msg)
+			if err != nil {
+				return delivered, err
+			}
+			if ok {
+				delivered++
+			}
+		}
+		if len(messages) < batchSize {
+			return delivered, nil
+		}
+	}
+}
+
+// deliver posts one message and records the outcome. A 2xx response counts
+// as delivered; anything else is retried after Backoff.
+func (d *Dispatcher) deliver(ctx context.Context, msg models.WebhookMessage) (bool, error) {
+	delivery := models.WebhookDelivery{MessageId: msg.Id, EventType: msg.EventType, Attempt: msg.Attempts + 1}
+	start := time.Now()
+	status, err := d.post(ctx, msg, start)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	delivery.StatusCode = status
+	switch {
+	case err != nil:
+		delivery.Error = err.Error()
+	case status < 200 || status > 299:
+		delivery.Error = fmt.Sprintf("unexpected status %d", status)
+	default:
+		delivery.Delivered = true
+	}
+	delivery.Error = truncate(delivery.Error, maxErrorLength)
+
+	var retryAt time.Time
+	if !delivery.Delivered {
+		if delivery.Attempt < MaxAttempts {
+			retryAt = start.Add(Backoff(delivery.Attempt))
+		} else {
+			log.Printf("webhook message id=%v was given up after %d attempts", msg.Id, delivery.Attempt)
+		}
+	}
+	return delivery.Delivered, d.store.RecordWebhookDelivery(ctx, delivery, start, retryAt)
+}
+
+func (d *Dispatcher) post(ctx context.Context, msg models.WebhookMessage, t time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, msg.URL, bytes.NewReader(msg.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", msg.EventType)
+	req.Header.Set("X-Webhook-Id", strconv.FormatInt(msg.Id, 10))
+	req.Header.Set(SignatureHeader, Sign(msg.Secret, t, msg.Payload))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// truncate shortens s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
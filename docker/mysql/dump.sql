@@ -1,3 +1,5 @@
+-- Runs on a fresh volume only; cmd/app/repository/database/migrate_mysql.go
+-- upgrades existing databases, keep the two in step.
 CREATE TABLE `tables` (
                            `id` INT NOT NULL auto_increment,
                            PRIMARY KEY (`id`),
@@ -5,13 +7,138 @@ CREATE TABLE `tables` (
                            booked_seats int,
                            available_seats int
 );
+CREATE TABLE `table_groups` (
+                           `id` INT NOT NULL auto_increment,
+                           PRIMARY KEY (`id`),
+                           name VARCHAR(100) NOT NULL
+);
+CREATE TABLE `table_group_members` (
+                           group_id INT NOT NULL,
+                           table_id INT NOT NULL,
+                           position int NOT NULL,
+                           PRIMARY KEY (group_id, table_id),
+                           FOREIGN KEY (group_id) REFERENCES table_groups(id),
+                           FOREIGN KEY (table_id) REFERENCES tables(id)
+);
 CREATE TABLE `guestsList` (
                           `id` INT NOT NULL auto_increment,
                           PRIMARY KEY (`id`),
                           table_id INT,
+                          table_group_id INT NULL,
                           name VARCHAR(100) NOT NULL,
                           accompanying_guests INT,
                           status int,
                           arrival_time bigint,
+                          rsvp_token VARCHAR(64) NULL UNIQUE,
+                          invited BOOLEAN NOT NULL DEFAULT FALSE,
+                          confirmation_code CHAR(6) NULL UNIQUE,
+                          checkin_used_at bigint NULL,
+                          dietary_needs VARCHAR(255) NOT NULL DEFAULT '',
+                          diet VARCHAR(20) NOT NULL DEFAULT '',
+                          gluten_free BOOLEAN NOT NULL DEFAULT FALSE,
+                          nut_allergy BOOLEAN NOT NULL DEFAULT FALSE,
+                          email VARCHAR(255) NOT NULL DEFAULT '',
+                          FOREIGN KEY (table_id) REFERENCES tables(id),
+                          FOREIGN KEY (table_group_id) REFERENCES table_groups(id)
+);
+CREATE TABLE `reservation_tables` (
+                          reservation_id INT NOT NULL,
+                          table_id INT NOT NULL,
+                          seats int NOT NULL,
+                          position int NOT NULL,
+                          PRIMARY KEY (reservation_id, table_id),
+                          FOREIGN KEY (reservation_id) REFERENCES guestsList(id),
                           FOREIGN KEY (table_id) REFERENCES tables(id)
 );
+CREATE TABLE `seats` (
+                          `id` INT NOT NULL auto_increment,
+                          PRIMARY KEY (`id`),
+                          table_id INT NOT NULL,
+                          position int NOT NULL,
+                          reservation_id INT NULL,
+                          guest_index int NULL,
+                          UNIQUE (table_id, position),
+                          FOREIGN KEY (table_id) REFERENCES tables(id),
+                          FOREIGN KEY (reservation_id) REFERENCES guestsList(id)
+);
+CREATE TABLE `party_members` (
+                          `id` INT NOT NULL auto_increment,
+                          PRIMARY KEY (`id`),
+                          reservation_id INT NOT NULL,
+                          name VARCHAR(100) NOT NULL,
+                          dietary_needs VARCHAR(255) NOT NULL DEFAULT '',
+                          age_group VARCHAR(10) NOT NULL DEFAULT 'adult',
+                          accessibility VARCHAR(255) NOT NULL DEFAULT '',
+                          diet VARCHAR(20) NOT NULL DEFAULT '',
+                          gluten_free BOOLEAN NOT NULL DEFAULT FALSE,
+                          nut_allergy BOOLEAN NOT NULL DEFAULT FALSE,
+                          FOREIGN KEY (reservation_id) REFERENCES guestsList(id)
+);
+CREATE TABLE `audit_log` (
+                          `id` INT NOT NULL auto_increment,
+                          PRIMARY KEY (`id`),
+                          occurred_at bigint NOT NULL,
+                          actor VARCHAR(100) NOT NULL,
+                          action VARCHAR(50) NOT NULL,
+                          reservation_id INT NULL,
+                          before_state TEXT NULL,
+                          after_state TEXT NULL,
+                          INDEX (reservation_id),
+                          INDEX (occurred_at)
+);
+CREATE TABLE `audit_log_tables` (
+                          audit_id INT NOT NULL,
+                          table_id INT NOT NULL,
+                          PRIMARY KEY (audit_id, table_id),
+                          INDEX (table_id),
+                          FOREIGN KEY (audit_id) REFERENCES audit_log(id)
+);
+CREATE TABLE `webhooks` (
+                          `id` INT NOT NULL auto_increment,
+                          PRIMARY KEY (`id`),
+                          url VARCHAR(2048) NOT NULL,
+                          event_type VARCHAR(50) NOT NULL,
+                          secret VARCHAR(100) NOT NULL,
+                          active BOOLEAN NOT NULL DEFAULT TRUE,
+                          INDEX (event_type)
+);
+CREATE TABLE `webhook_outbox` (
+                          `id` INT NOT NULL auto_increment,
+                          PRIMARY KEY (`id`),
+                          webhook_id INT NOT NULL,
+                          event_type VARCHAR(50) NOT NULL,
+                          payload TEXT NOT NULL,
+                          created_at bigint NOT NULL,
+                          attempts int NOT NULL DEFAULT 0,
+                          next_attempt_at bigint NULL,
+                          delivered_at bigint NULL,
+                          INDEX (next_attempt_at),
+                          FOREIGN KEY (webhook_id) REFERENCES webhooks(id)
+);
+CREATE TABLE `webhook_deliveries` (
+                          `id` INT NOT NULL auto_increment,
+                          PRIMARY KEY (`id`),
+                          message_id INT NOT NULL,
+                          attempt int NOT NULL,
+                          attempted_at bigint NOT NULL,
+                          status_code int NOT NULL,
+                          error VARCHAR(255) NOT NULL DEFAULT '',
+                          duration_ms bigint NOT NULL,
+                          delivered BOOLEAN NOT NULL,
+                          FOREIGN KEY (message_id) REFERENCES webhook_outbox(id)
+);
+CREATE TABLE `notifications` (
+                          `id` INT NOT NULL auto_increment,
+                          PRIMARY KEY (`id`),
+                          reservation_id INT NOT NULL,
+                          kind VARCHAR(30) NOT NULL,
+                          recipient VARCHAR(255) NOT NULL,
+                          payload TEXT NOT NULL,
+                          created_at bigint NOT NULL,
+                          attempts int NOT NULL DEFAULT 0,
+                          next_attempt_at bigint NULL,
+                          sent_at bigint NULL,
+                          last_error VARCHAR(255) NOT NULL DEFAULT '',
+                          INDEX (reservation_id),
+                          INDEX (next_attempt_at)
+);